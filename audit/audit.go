@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"github.com/dfryer1193/mjolnir/auth"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var logger = logx.Named("audit")
+
+type ctxKey int
+
+const scopeKey ctxKey = iota
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+var (
+	// ErrClosed is returned when recording to a Logger that has been closed
+	ErrClosed = errors.New("audit: logger is closed")
+	// ErrNoLogger is returned by Record when the request was not served through Middleware
+	ErrNoLogger = errors.New("audit: no logger in context")
+)
+
+// Event records who did what to which resource. Fields describing the request are filled
+// in from the context by Logger.Record unless already set.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Action is what was done, such as "user.delete"
+	Action string `json:"action"`
+	// Resource and ResourceID identify what it was done to
+	Resource   string `json:"resource,omitempty"`
+	ResourceID string `json:"resource_id,omitempty"`
+	// Outcome is one of OutcomeSuccess, OutcomeFailure or OutcomeDenied. Defaults to
+	// OutcomeSuccess.
+	Outcome string `json:"outcome"`
+	// Actor is the ID of the authenticated principal
+	Actor       string `json:"actor,omitempty"`
+	ActorScheme string `json:"actor_scheme,omitempty"`
+	RequestID   string `json:"request_id,omitempty"`
+	ClientIP    string `json:"client_ip,omitempty"`
+	Method      string `json:"method,omitempty"`
+	Route       string `json:"route,omitempty"`
+	// Details holds action-specific data, such as the fields that changed
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Sink stores audit events. Implementations must be safe for concurrent use.
+type Sink interface {
+	// Write stores e, returning an error if it could not be stored
+	Write(e Event) error
+	// Close flushes buffered events to durable storage and releases the sink
+	Close() error
+}
+
+// Logger records audit events to a Sink, separately from the operational log
+type Logger struct {
+	sink Sink
+	now  func() time.Time
+
+	// mu is held for reading while writing so that Close waits for writes in progress
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewLogger returns a Logger writing to sink
+func NewLogger(sink Sink) *Logger {
+	if sink == nil {
+		panic("audit: sink must not be nil")
+	}
+	return &Logger{sink: sink, now: time.Now}
+}
+
+// Record enriches e with the request ID, principal, client address, method and route found
+// in ctx and writes it to the sink. Events are written synchronously, so with the default
+// FileSink an event is on disk, or an error returned, before the handler responds. A
+// Buffered FileSink only keeps it in memory until the next flush.
+func (l *Logger) Record(ctx context.Context, e Event) error {
+	l.enrich(ctx, &e)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return ErrClosed
+	}
+	return l.sink.Write(e)
+}
+
+func (l *Logger) enrich(ctx context.Context, e *Event) {
+	if e.Time.IsZero() {
+		e.Time = l.now().UTC()
+	}
+	if e.Outcome == "" {
+		e.Outcome = OutcomeSuccess
+	}
+	if e.Actor == "" {
+		if principal, ok := auth.GetPrincipal(ctx); ok {
+			e.Actor = principal.ID
+			e.ActorScheme = principal.Scheme
+		}
+	}
+	if e.RequestID == "" {
+		e.RequestID = middleware.GetRequestID(ctx)
+	}
+
+	scope, _ := ctx.Value(scopeKey).(*requestScope)
+	if e.ClientIP == "" {
+		if info, ok := middleware.GetClientInfo(ctx); ok && info.IP.IsValid() {
+			e.ClientIP = info.IP.String()
+		} else if scope != nil {
+			e.ClientIP = scope.clientIP
+		}
+	}
+	if e.Method == "" {
+		if scope != nil {
+			e.Method = scope.method
+		} else if rctx := chi.RouteContext(ctx); rctx != nil {
+			e.Method = rctx.RouteMethod
+		}
+	}
+	if e.Route == "" {
+		if route, ok := middleware.GetRoute(ctx); ok {
+			e.Route = route.Pattern
+		}
+	}
+}
+
+// Close waits for writes in progress, then flushes and closes the sink. Call it after
+// http.Server.Shutdown returns, or use Shutdown, so that events recorded by the last
+// requests are kept.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	return l.sink.Close()
+}
+
+// Shutdown gracefully shuts down srv and then closes l, so that events recorded by the last
+// requests are flushed before it returns. Requests still running when ctx expires fail to
+// record with ErrClosed.
+func (l *Logger) Shutdown(ctx context.Context, srv *http.Server) error {
+	err := srv.Shutdown(ctx)
+	if closeErr := l.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// requestScope carries the Logger and request details that are not otherwise in the
+// context
+type requestScope struct {
+	logger   *Logger
+	method   string
+	clientIP string
+}
+
+// Middleware makes l available to handlers through Record
+func Middleware(l *Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := &requestScope{logger: l, method: r.Method, clientIP: middleware.ClientIP(r)}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeKey, scope)))
+		})
+	}
+}
+
+// Record records e with the Logger installed by Middleware
+func Record(ctx context.Context, e Event) error {
+	scope, ok := ctx.Value(scopeKey).(*requestScope)
+	if !ok {
+		return ErrNoLogger
+	}
+	return scope.logger.Record(ctx, e)
+}
@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"github.com/dfryer1193/mjolnir/auth"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordEnrichesFromRequest(t *testing.T) {
+	sink := NewMemorySink()
+	logger := NewLogger(sink)
+	logger.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID, Middleware(logger))
+	r.Delete("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := auth.WithPrincipal(r.Context(), &auth.Principal{ID: "admin", Scheme: "Bearer"})
+		err := Record(ctx, Event{
+			Action:     "user.delete",
+			Resource:   "user",
+			ResourceID: chi.URLParam(r, "id"),
+			Details:    map[string]any{"reason": "requested"},
+		})
+		if err != nil {
+			t.Errorf("Record() error = %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/42", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	expected := []Event{{
+		Time:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Action:      "user.delete",
+		Resource:    "user",
+		ResourceID:  "42",
+		Outcome:     OutcomeSuccess,
+		Actor:       "admin",
+		ActorScheme: "Bearer",
+		RequestID:   "req-1",
+		ClientIP:    "192.0.2.1",
+		Method:      http.MethodDelete,
+		Route:       "/users/{id}",
+		Details:     map[string]any{"reason": "requested"},
+	}}
+	if got := sink.Events(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("events = %+v\nwant %+v", got, expected)
+	}
+}
+
+func TestRecordKeepsExplicitFields(t *testing.T) {
+	sink := NewMemorySink()
+	logger := NewLogger(sink)
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{ID: "alice"})
+	err := logger.Record(ctx, Event{Action: "job.run", Actor: "scheduler", Outcome: OutcomeFailure})
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	got := sink.Events()[0]
+	if got.Actor != "scheduler" || got.Outcome != OutcomeFailure || got.Time.IsZero() {
+		t.Errorf("event = %+v", got)
+	}
+}
+
+func TestRecordWithoutMiddleware(t *testing.T) {
+	if err := Record(context.Background(), Event{Action: "x"}); !errors.Is(err, ErrNoLogger) {
+		t.Errorf("Record() error = %v, want ErrNoLogger", err)
+	}
+}
+
+func TestLoggerClose(t *testing.T) {
+	sink := NewMemorySink()
+	logger := NewLogger(sink)
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := logger.Record(context.Background(), Event{Action: "x"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Record() after Close error = %v, want ErrClosed", err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestLoggerShutdown(t *testing.T) {
+	sink := NewMemorySink()
+	logger := NewLogger(sink)
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		if err := Record(r.Context(), Event{Action: "last.request"}); err != nil {
+			t.Errorf("Record() error = %v", err)
+		}
+	})))
+	defer srv.Close()
+
+	go http.Get(srv.URL)
+	<-entered
+
+	shutdown := make(chan error)
+	go func() { shutdown <- logger.Shutdown(context.Background(), srv.Config) }()
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if events := sink.Events(); len(events) != 1 || events[0].Action != "last.request" {
+		t.Errorf("events = %+v, want the event from the in-flight request", events)
+	}
+	if err := logger.Record(context.Background(), Event{Action: "x"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Record() after Shutdown error = %v, want ErrClosed", err)
+	}
+}
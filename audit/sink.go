@@ -0,0 +1,301 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrTampered is returned by Verify when a record does not match the hash chain
+var ErrTampered = errors.New("audit: log has been tampered with")
+
+// MemorySink keeps events in memory, for tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+	closed bool
+}
+
+// NewMemorySink returns an empty MemorySink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (m *MemorySink) Write(e Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.events = append(m.events, e)
+	return nil
+}
+
+// Events returns the events written so far
+func (m *MemorySink) Events() []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Event(nil), m.events...)
+}
+
+func (m *MemorySink) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// FileOptions configures a FileSink. By default every event is written and fsynced before
+// Write returns, so that a crash loses nothing that was recorded.
+type FileOptions struct {
+	// Buffered batches events in memory and writes them every FlushInterval and on Close,
+	// trading up to FlushInterval of events lost on a crash for throughput
+	Buffered bool
+	// FlushInterval is how often buffered events are written to the file. Defaults to one
+	// second; ignored unless Buffered is set.
+	FlushInterval time.Duration
+	// Key makes the chain an HMAC-SHA-256 chain, so that the file cannot be rewritten
+	// consistently without the key. The same key must be passed to Verify.
+	Key []byte
+}
+
+// record is one line of a FileSink. Hash is the SHA-256, or HMAC-SHA-256 with a key, of the
+// previous record's hash, Seq and the event, so that editing, removing or reordering
+// records breaks the chain.
+type record struct {
+	Seq   uint64          `json:"seq"`
+	Prev  string          `json:"prev"`
+	Hash  string          `json:"hash"`
+	Event json.RawMessage `json:"event"`
+}
+
+func chainHash(key []byte, prev string, seq uint64, event []byte) string {
+	h := sha256.New()
+	if len(key) > 0 {
+		h = hmac.New(sha256.New, key)
+	}
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(strconv.AppendUint(nil, seq, 10))
+	h.Write([]byte{'\n'})
+	h.Write(event)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// FileSink appends events to a file as JSON lines forming a hash chain, which Verify
+// checks for tampering
+type FileSink struct {
+	opts FileOptions
+
+	mu   sync.Mutex
+	f    *os.File
+	buf  *bufio.Writer
+	seq  uint64
+	prev string
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// OpenFileSink opens path for appending, continuing the hash chain of any records already
+// in it. A final record torn by a crash is removed, and the chain continues from the last
+// complete record.
+func OpenFileSink(path string, opts FileOptions) (*FileSink, error) {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	last, err := lastRecord(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit: reading %s: %w", path, err)
+	}
+
+	s := &FileSink{
+		opts:    opts,
+		f:       f,
+		buf:     bufio.NewWriter(f),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if last != nil {
+		s.seq, s.prev = last.Seq, last.Hash
+	}
+	if opts.Buffered {
+		go s.flushLoop()
+	} else {
+		close(s.stopped)
+	}
+	return s, nil
+}
+
+// lastRecord returns the last record in f. A final line without a newline was cut short by
+// a crash: it is completed if it holds a whole record and truncated otherwise.
+func lastRecord(f *os.File) (*record, error) {
+	var (
+		last *record
+		end  int64 // offset just past the last complete line
+	)
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		torn := errors.Is(err, io.EOF) && len(line) > 0
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			rec := &record{}
+			if jsonErr := json.Unmarshal(trimmed, rec); jsonErr != nil {
+				if !torn {
+					return nil, jsonErr
+				}
+				logger.Warn(context.Background(), "removing torn audit record",
+					slog.String("path", f.Name()),
+					slog.Int("bytes", len(line)))
+				return last, f.Truncate(end)
+			}
+			last = rec
+		}
+		if torn {
+			_, err := f.Write([]byte{'\n'})
+			return last, err
+		}
+		if errors.Is(err, io.EOF) {
+			return last, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		end += int64(len(line))
+	}
+}
+
+func (s *FileSink) Write(e Event) error {
+	event, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	rec := record{Seq: s.seq + 1, Prev: s.prev, Event: event}
+	rec.Hash = chainHash(s.opts.Key, rec.Prev, rec.Seq, event)
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.buf.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.seq, s.prev = rec.Seq, rec.Hash
+
+	if !s.opts.Buffered {
+		return s.flushLocked(true)
+	}
+	return nil
+}
+
+func (s *FileSink) flushLoop() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.f != nil {
+				if err := s.flushLocked(false); err != nil {
+					logger.Error(context.Background(), "failed to flush audit log", logx.Err(err), slog.String("path", s.f.Name()))
+				}
+			}
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *FileSink) flushLocked(fsync bool) error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if fsync {
+		return s.f.Sync()
+	}
+	return nil
+}
+
+// Close flushes and fsyncs buffered events and closes the file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	if s.f == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	err := s.flushLocked(true)
+	if closeErr := s.f.Close(); err == nil {
+		err = closeErr
+	}
+	s.f = nil
+	s.mu.Unlock()
+
+	close(s.done)
+	<-s.stopped
+	return err
+}
+
+// Verify checks the hash chain of a FileSink's output, using the sink's Key if it had one,
+// and returns the number of records read. It returns an error wrapping ErrTampered at the
+// first record that does not match. Truncation of the newest records cannot be detected
+// from the file alone; keep the last hash elsewhere to detect it.
+func Verify(r io.Reader, key []byte) (int, error) {
+	var (
+		count int
+		seq   uint64
+		prev  string
+	)
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var rec record
+			if jsonErr := json.Unmarshal(line, &rec); jsonErr != nil {
+				return count, fmt.Errorf("%w: record %d is malformed: %v", ErrTampered, count+1, jsonErr)
+			}
+			switch {
+			case rec.Seq != seq+1:
+				return count, fmt.Errorf("%w: record %d has sequence %d, want %d", ErrTampered, count+1, rec.Seq, seq+1)
+			case rec.Prev != prev:
+				return count, fmt.Errorf("%w: record %d does not follow the previous record", ErrTampered, count+1)
+			case rec.Hash != chainHash(key, rec.Prev, rec.Seq, rec.Event):
+				return count, fmt.Errorf("%w: record %d does not match its hash", ErrTampered, count+1)
+			}
+			seq, prev = rec.Seq, rec.Hash
+			count++
+		}
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
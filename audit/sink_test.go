@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeEvents(t *testing.T, path string, opts FileOptions, actions ...string) {
+	t.Helper()
+	sink, err := OpenFileSink(path, opts)
+	if err != nil {
+		t.Fatalf("OpenFileSink() error = %v", err)
+	}
+	for _, action := range actions {
+		if err := sink.Write(Event{Time: time.Unix(0, 0).UTC(), Action: action, Outcome: OutcomeSuccess}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestFileSinkChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	// Reopening continues the chain
+	writeEvents(t, path, FileOptions{}, "a", "b")
+	writeEvents(t, path, FileOptions{}, "c")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := Verify(bytes.NewReader(data), nil)
+	if err != nil || n != 3 {
+		t.Fatalf("Verify() = %d, %v; want 3 records", n, err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "edited event",
+			content: strings.Replace(string(data), `"action":"b"`, `"action":"x"`, 1),
+		},
+		{
+			name:    "removed record",
+			content: lines[0] + lines[2],
+		},
+		{
+			name:    "removed first record",
+			content: lines[1] + lines[2],
+		},
+		{
+			name:    "reordered records",
+			content: lines[1] + lines[0] + lines[2],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Verify(strings.NewReader(tt.content), nil); !errors.Is(err, ErrTampered) {
+				t.Errorf("Verify() error = %v, want ErrTampered", err)
+			}
+		})
+	}
+}
+
+func TestFileSinkKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	key := []byte("secret")
+	writeEvents(t, path, FileOptions{Key: key}, "a", "b")
+
+	data, _ := os.ReadFile(path)
+	if _, err := Verify(bytes.NewReader(data), key); err != nil {
+		t.Errorf("Verify() with key error = %v", err)
+	}
+	if _, err := Verify(bytes.NewReader(data), nil); !errors.Is(err, ErrTampered) {
+		t.Errorf("Verify() without key error = %v, want ErrTampered", err)
+	}
+}
+
+func TestFileSinkFlushes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := OpenFileSink(path, FileOptions{Buffered: true, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(Event{Action: "a"})
+
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("expected the event to be buffered, file has %q", data)
+	}
+	if err := NewLogger(sink).Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"action":"a"`) {
+		t.Errorf("expected the event to be flushed on Close, file has %q", data)
+	}
+	if err := sink.Write(Event{Action: "b"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write() after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestFileSinkDurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := OpenFileSink(path, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	sink.Write(Event{Action: "a"})
+
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"action":"a"`) {
+		t.Errorf("expected the event to be written immediately, file has %q", data)
+	}
+}
+
+func TestFileSinkRecoversTornRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		// cut returns the file content left by a crash
+		cut func(content string) string
+	}{
+		{
+			name: "partial record",
+			cut:  func(content string) string { return content + `{"seq":3,"prev":"ab` },
+		},
+		{
+			name: "record without newline",
+			cut:  func(content string) string { return strings.TrimSuffix(content, "\n") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			writeEvents(t, path, FileOptions{}, "a", "b")
+
+			data, _ := os.ReadFile(path)
+			if err := os.WriteFile(path, []byte(tt.cut(string(data))), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			writeEvents(t, path, FileOptions{}, "c")
+
+			data, _ = os.ReadFile(path)
+			n, err := Verify(bytes.NewReader(data), nil)
+			if err != nil || n != 3 {
+				t.Errorf("Verify() = %d, %v; want 3 records\n%s", n, err, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
+	"net/http"
+)
+
+var logger = logx.Named("auth")
+
+type ctxKey int
+
+const principalKey ctxKey = iota
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request carries no
+	// credentials for its scheme, allowing the next authenticator to be tried
+	ErrNoCredentials = errors.New("no credentials provided")
+	// ErrInvalidCredentials is returned when credentials are present but not accepted
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is the identity resolved for an authenticated request
+type Principal struct {
+	ID     string
+	Scheme string
+	Scopes []string
+	Roles  []string
+	// Attributes holds scheme-specific data such as token claims
+	Attributes map[string]any
+}
+
+// Authenticator resolves the principal for a request using a single scheme
+type Authenticator interface {
+	// Authenticate returns the principal for r, ErrNoCredentials when r carries no
+	// credentials for this scheme, or another error when the credentials are rejected
+	Authenticate(r *http.Request) (*Principal, error)
+	// Challenge returns the WWW-Authenticate challenge for this scheme. err is the
+	// authentication error, or nil when no credentials were provided.
+	Challenge(err error) string
+}
+
+// Options configures the authentication middleware
+type Options struct {
+	// Authenticators are tried in order until one finds credentials in the request
+	Authenticators []Authenticator
+	// Optional lets requests without credentials through unauthenticated. Requests with
+	// rejected credentials are still refused.
+	Optional bool
+}
+
+// New returns a middleware that authenticates requests and stores the resolved principal
+// in the request context. Requests that are not authenticated receive 401 with a
+// WWW-Authenticate challenge for each configured scheme.
+func New(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, authenticator := range opts.Authenticators {
+				principal, err := authenticator.Authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err == nil && principal == nil {
+					err = ErrInvalidCredentials
+				}
+				if err != nil {
+					logger.Debug(r.Context(), "authentication failed",
+						slog.String("request_id", middleware.GetRequestID(r.Context())),
+						logx.Err(err))
+					w.Header().Add("WWW-Authenticate", authenticator.Challenge(err))
+					errorx.HandleError(w, r, errorx.UnauthorizedErr(ErrInvalidCredentials))
+					return
+				}
+
+				middleware.SetLogField(r.Context(), "principal", principal.ID)
+				next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+				return
+			}
+
+			if opts.Optional {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, authenticator := range opts.Authenticators {
+				w.Header().Add("WWW-Authenticate", authenticator.Challenge(nil))
+			}
+			errorx.HandleError(w, r, errorx.UnauthorizedErr(errors.New("authentication required")))
+		})
+	}
+}
+
+// WithPrincipal returns a copy of ctx carrying principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// GetPrincipal returns the principal stored in ctx, if any
+func GetPrincipal(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// PrincipalID returns the ID of the request's principal, or an empty string for
+// unauthenticated requests. It can be used as a rate limiting key.
+func PrincipalID(r *http.Request) string {
+	if principal, ok := GetPrincipal(r.Context()); ok {
+		return principal.ID
+	}
+	return ""
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testAuthenticators() []Authenticator {
+	return []Authenticator{
+		&BearerToken{
+			Realm: "api",
+			Validate: func(_ context.Context, token string) (*Principal, error) {
+				if token == "good-token" {
+					return &Principal{ID: "token-user", Scopes: []string{"read"}}, nil
+				}
+				return nil, ErrInvalidCredentials
+			},
+		},
+		&BasicAuth{
+			Realm: "api",
+			Verify: func(_ context.Context, username, password string) (*Principal, error) {
+				if username == "alice" && password == "secret" {
+					return &Principal{ID: "alice"}, nil
+				}
+				return nil, ErrInvalidCredentials
+			},
+		},
+		&APIKey{
+			Header: "X-API-Key",
+			Query:  "api_key",
+			Lookup: StaticAPIKeys(map[string]Principal{
+				"key-123": {ID: "service-a", Roles: []string{"service"}},
+			}),
+		},
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name               string
+		optional           bool
+		setup              func(r *http.Request)
+		expectedCode       int
+		expectedPrincipal  string
+		expectedScheme     string
+		expectedChallenges []string
+	}{
+		{
+			name: "valid bearer token",
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer good-token")
+			},
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: "token-user",
+			expectedScheme:    "Bearer",
+		},
+		{
+			name: "invalid bearer token",
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer bad-token")
+			},
+			expectedCode:       http.StatusUnauthorized,
+			expectedChallenges: []string{`Bearer realm="api", error="invalid_token"`},
+		},
+		{
+			name: "valid basic credentials",
+			setup: func(r *http.Request) {
+				r.SetBasicAuth("alice", "secret")
+			},
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: "alice",
+			expectedScheme:    "Basic",
+		},
+		{
+			name: "invalid basic credentials",
+			setup: func(r *http.Request) {
+				r.SetBasicAuth("alice", "wrong")
+			},
+			expectedCode:       http.StatusUnauthorized,
+			expectedChallenges: []string{`Basic realm="api", charset="UTF-8"`},
+		},
+		{
+			name: "api key header",
+			setup: func(r *http.Request) {
+				r.Header.Set("X-API-Key", "key-123")
+			},
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: "service-a",
+			expectedScheme:    "APIKey",
+		},
+		{
+			name: "api key query",
+			setup: func(r *http.Request) {
+				r.URL.RawQuery = "api_key=key-123"
+			},
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: "service-a",
+		},
+		{
+			name: "unknown api key",
+			setup: func(r *http.Request) {
+				r.Header.Set("X-API-Key", "nope")
+			},
+			expectedCode:       http.StatusUnauthorized,
+			expectedChallenges: []string{"APIKey"},
+		},
+		{
+			name:         "no credentials",
+			setup:        func(r *http.Request) {},
+			expectedCode: http.StatusUnauthorized,
+			expectedChallenges: []string{
+				`Bearer realm="api"`,
+				`Basic realm="api", charset="UTF-8"`,
+				"APIKey",
+			},
+		},
+		{
+			name:         "no credentials with optional auth",
+			optional:     true,
+			setup:        func(r *http.Request) {},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:     "invalid credentials with optional auth",
+			optional: true,
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer bad-token")
+			},
+			expectedCode:       http.StatusUnauthorized,
+			expectedChallenges: []string{`Bearer realm="api", error="invalid_token"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal *Principal
+			handler := New(Options{Authenticators: testAuthenticators(), Optional: tt.optional})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					principal, _ = GetPrincipal(r.Context())
+				}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(req)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			challenges := rr.Header().Values("WWW-Authenticate")
+			if len(challenges) != len(tt.expectedChallenges) {
+				t.Fatalf("WWW-Authenticate = %q, want %q", challenges, tt.expectedChallenges)
+			}
+			for i := range challenges {
+				if challenges[i] != tt.expectedChallenges[i] {
+					t.Errorf("challenge %d = %q, want %q", i, challenges[i], tt.expectedChallenges[i])
+				}
+			}
+
+			if tt.expectedPrincipal == "" {
+				if principal != nil {
+					t.Errorf("unexpected principal %+v", principal)
+				}
+				return
+			}
+			if principal == nil || principal.ID != tt.expectedPrincipal {
+				t.Fatalf("principal = %+v, want ID %q", principal, tt.expectedPrincipal)
+			}
+			if tt.expectedScheme != "" && principal.Scheme != tt.expectedScheme {
+				t.Errorf("scheme = %q, want %q", principal.Scheme, tt.expectedScheme)
+			}
+		})
+	}
+}
+
+func TestMiddlewareNilPrincipalIsRejected(t *testing.T) {
+	bearer := &BearerToken{Validate: func(context.Context, string) (*Principal, error) {
+		return nil, nil
+	}}
+	handler := New(Options{Authenticators: []Authenticator{bearer}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler should not be called")
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer anything")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rr.Code)
+	}
+}
+
+func TestGetPrincipal(t *testing.T) {
+	if _, ok := GetPrincipal(context.Background()); ok {
+		t.Error("expected no principal in empty context")
+	}
+
+	ctx := WithPrincipal(context.Background(), &Principal{ID: "p1"})
+	principal, ok := GetPrincipal(ctx)
+	if !ok || principal.ID != "p1" {
+		t.Errorf("GetPrincipal() = %+v, %v", principal, ok)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := PrincipalID(req); got != "" {
+		t.Errorf("PrincipalID() for anonymous request = %q", got)
+	}
+	if got := PrincipalID(req.WithContext(ctx)); got != "p1" {
+		t.Errorf("PrincipalID() = %q, want p1", got)
+	}
+}
+
+func TestStaticAPIKeys(t *testing.T) {
+	lookup := StaticAPIKeys(map[string]Principal{"k1": {ID: "one"}, "k2": {ID: "two"}})
+
+	p, err := lookup(context.Background(), "k2")
+	if err != nil || p.ID != "two" {
+		t.Errorf("lookup(k2) = %+v, %v", p, err)
+	}
+
+	p.ID = "mutated"
+	if again, _ := lookup(context.Background(), "k2"); again.ID != "two" {
+		t.Error("returned principal aliases the configured value")
+	}
+
+	if _, err := lookup(context.Background(), "k3"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("lookup(k3) error = %v, want ErrInvalidCredentials", err)
+	}
+}
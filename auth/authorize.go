@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strings"
+)
+
+// PermissionError reports the permission a policy found missing. Policies return it to deny
+// a request with 403; any other error is treated as a failure to evaluate the policy.
+type PermissionError struct {
+	Policy  string   `json:"policy"`
+	Missing []string `json:"missing,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+func (e *PermissionError) Error() string {
+	msg := "permission denied by " + e.Policy
+	if len(e.Missing) > 0 {
+		msg += ": missing " + strings.Join(e.Missing, ", ")
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Policy decides whether principal may perform the request. It returns nil to allow the
+// request, a *PermissionError to deny it, or another error if it could not be evaluated.
+type Policy func(r *http.Request, principal *Principal) error
+
+// Require returns a middleware that enforces every policy against the request's principal.
+// Requests without a principal receive 401, denied requests receive 403 listing the missing
+// permission in details, and policy evaluation failures receive 500.
+func Require(policies ...Policy) func(http.Handler) http.Handler {
+	policy := AllOf(policies...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := GetPrincipal(r.Context())
+			if !ok {
+				errorx.HandleError(w, r, errorx.UnauthorizedErr(errors.New("authentication required")))
+				return
+			}
+
+			err := policy(r, principal)
+			if err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var denied *PermissionError
+			if errors.As(err, &denied) {
+				middleware.SetLogField(r.Context(), "authz_denied", denied.Policy)
+				errorx.HandleError(w, r, errorx.ForbiddenErr(errors.New("insufficient permissions")).WithDetails(denied))
+				return
+			}
+			errorx.HandleError(w, r, errorx.InternalServerErr(fmt.Errorf("failed to evaluate authorization policy: %w", err)))
+		})
+	}
+}
+
+// Guard returns a router whose routes require every policy, for declaring permissions
+// alongside route registration:
+//
+//	auth.Guard(r, auth.HasScopes("orders:write")).Post("/orders", createOrder)
+func Guard(r chi.Router, policies ...Policy) chi.Router {
+	return r.With(Require(policies...))
+}
+
+// HasScopes requires the principal to hold every scope
+func HasScopes(scopes ...string) Policy {
+	return func(_ *http.Request, principal *Principal) error {
+		if missing := missingValues(principal.Scopes, scopes); len(missing) > 0 {
+			return &PermissionError{Policy: "scopes", Missing: missing}
+		}
+		return nil
+	}
+}
+
+// HasAnyScope requires the principal to hold at least one of the scopes. It panics if no
+// scopes are given, since the policy would deny every request.
+func HasAnyScope(scopes ...string) Policy {
+	if len(scopes) == 0 {
+		panic("auth: HasAnyScope requires at least one scope")
+	}
+	return func(_ *http.Request, principal *Principal) error {
+		if len(missingValues(principal.Scopes, scopes)) == len(scopes) {
+			return &PermissionError{Policy: "any_scope", Missing: scopes}
+		}
+		return nil
+	}
+}
+
+// HasRoles requires the principal to hold every role
+func HasRoles(roles ...string) Policy {
+	return func(_ *http.Request, principal *Principal) error {
+		if missing := missingValues(principal.Roles, roles); len(missing) > 0 {
+			return &PermissionError{Policy: "roles", Missing: missing}
+		}
+		return nil
+	}
+}
+
+// HasAnyRole requires the principal to hold at least one of the roles. It panics if no
+// roles are given, since the policy would deny every request.
+func HasAnyRole(roles ...string) Policy {
+	if len(roles) == 0 {
+		panic("auth: HasAnyRole requires at least one role")
+	}
+	return func(_ *http.Request, principal *Principal) error {
+		if len(missingValues(principal.Roles, roles)) == len(roles) {
+			return &PermissionError{Policy: "any_role", Missing: roles}
+		}
+		return nil
+	}
+}
+
+// Allow adapts a predicate, such as a resource ownership check, into a policy named name
+func Allow(name string, allowed func(r *http.Request, principal *Principal) (bool, error)) Policy {
+	return func(r *http.Request, principal *Principal) error {
+		ok, err := allowed(r, principal)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &PermissionError{Policy: name}
+		}
+		return nil
+	}
+}
+
+// AllOf requires every policy to allow the request, returning the first denial
+func AllOf(policies ...Policy) Policy {
+	return func(r *http.Request, principal *Principal) error {
+		for _, policy := range policies {
+			if err := policy(r, principal); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyOf requires at least one policy to allow the request. When all deny, the missing
+// permissions of every policy are reported together. It panics if no policies are given,
+// since the policy would deny every request.
+func AnyOf(policies ...Policy) Policy {
+	if len(policies) == 0 {
+		panic("auth: AnyOf requires at least one policy")
+	}
+	return func(r *http.Request, principal *Principal) error {
+		combined := &PermissionError{Policy: "any_of"}
+		for _, policy := range policies {
+			err := policy(r, principal)
+			if err == nil {
+				return nil
+			}
+
+			var denied *PermissionError
+			if !errors.As(err, &denied) {
+				return err
+			}
+			combined.Missing = append(combined.Missing, denied.Missing...)
+			if len(denied.Missing) == 0 {
+				combined.Missing = append(combined.Missing, denied.Policy)
+			}
+		}
+		return combined
+	}
+}
+
+// missingValues returns the required values not present in held
+func missingValues(held, required []string) []string {
+	var missing []string
+	for _, r := range required {
+		found := false
+		for _, h := range held {
+			if h == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
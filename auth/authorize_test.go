@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	ownsDocument := Allow("owner", func(r *http.Request, p *Principal) (bool, error) {
+		return r.URL.Query().Get("owner") == p.ID, nil
+	})
+	failing := Policy(func(*http.Request, *Principal) error {
+		return errors.New("policy store unavailable")
+	})
+	principal := &Principal{ID: "alice", Scopes: []string{"docs:read"}, Roles: []string{"editor"}}
+
+	tests := []struct {
+		name            string
+		principal       *Principal
+		query           string
+		policies        []Policy
+		expectedCode    int
+		expectedDetails *PermissionError
+	}{
+		{
+			name:         "no principal",
+			policies:     []Policy{HasScopes("docs:read")},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "scopes held",
+			principal:    principal,
+			policies:     []Policy{HasScopes("docs:read")},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:            "scope missing",
+			principal:       principal,
+			policies:        []Policy{HasScopes("docs:read", "docs:write")},
+			expectedCode:    http.StatusForbidden,
+			expectedDetails: &PermissionError{Policy: "scopes", Missing: []string{"docs:write"}},
+		},
+		{
+			name:         "any scope",
+			principal:    principal,
+			policies:     []Policy{HasAnyScope("docs:write", "docs:read")},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:            "role missing",
+			principal:       principal,
+			policies:        []Policy{HasScopes("docs:read"), HasRoles("admin")},
+			expectedCode:    http.StatusForbidden,
+			expectedDetails: &PermissionError{Policy: "roles", Missing: []string{"admin"}},
+		},
+		{
+			name:            "no matching role",
+			principal:       principal,
+			policies:        []Policy{HasAnyRole("admin", "owner")},
+			expectedCode:    http.StatusForbidden,
+			expectedDetails: &PermissionError{Policy: "any_role", Missing: []string{"admin", "owner"}},
+		},
+		{
+			name:         "owner allowed",
+			principal:    principal,
+			query:        "owner=alice",
+			policies:     []Policy{ownsDocument},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:            "owner denied",
+			principal:       principal,
+			query:           "owner=bob",
+			policies:        []Policy{ownsDocument},
+			expectedCode:    http.StatusForbidden,
+			expectedDetails: &PermissionError{Policy: "owner"},
+		},
+		{
+			name:         "admin or owner",
+			principal:    principal,
+			query:        "owner=alice",
+			policies:     []Policy{AnyOf(HasRoles("admin"), ownsDocument)},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:            "neither admin nor owner",
+			principal:       principal,
+			query:           "owner=bob",
+			policies:        []Policy{AnyOf(HasRoles("admin"), ownsDocument)},
+			expectedCode:    http.StatusForbidden,
+			expectedDetails: &PermissionError{Policy: "any_of", Missing: []string{"admin", "owner"}},
+		},
+		{
+			name:         "policy failure",
+			principal:    principal,
+			policies:     []Policy{failing},
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Require(tt.policies...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			if tt.principal != nil {
+				req = req.WithContext(WithPrincipal(req.Context(), tt.principal))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expectedDetails == nil {
+				return
+			}
+
+			var body struct {
+				Details *PermissionError `json:"details"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(body.Details, tt.expectedDetails) {
+				t.Errorf("details = %+v, want %+v", body.Details, tt.expectedDetails)
+			}
+		})
+	}
+}
+
+func TestGuard(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			principal := &Principal{ID: "alice", Scopes: []string{"orders:read"}}
+			next.ServeHTTP(w, req.WithContext(WithPrincipal(req.Context(), principal)))
+		})
+	})
+	r.Get("/orders", func(w http.ResponseWriter, r *http.Request) {})
+	Guard(r, HasScopes("orders:write")).Post("/orders", func(w http.ResponseWriter, r *http.Request) {})
+
+	for method, expected := range map[string]int{http.MethodGet: http.StatusOK, http.MethodPost: http.StatusForbidden} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(method, "/orders", nil))
+		if rr.Code != expected {
+			t.Errorf("%s /orders: expected status %d, got %d", method, expected, rr.Code)
+		}
+	}
+}
+
+func TestEmptyAnyPoliciesPanic(t *testing.T) {
+	tests := map[string]func(){
+		"HasAnyScope": func() { HasAnyScope() },
+		"HasAnyRole":  func() { HasAnyRole() },
+		"AnyOf":       func() { AnyOf() },
+	}
+
+	for name, construct := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected %s() to panic without arguments", name)
+				}
+			}()
+			construct()
+		})
+	}
+}
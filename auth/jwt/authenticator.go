@@ -0,0 +1,55 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/auth"
+)
+
+const claimsAttribute = "jwt_claims"
+
+// AuthenticatorOptions configures how verified claims are mapped to a principal
+type AuthenticatorOptions struct {
+	Realm string
+	// RolesClaim names the claim holding the principal's roles. Defaults to "roles".
+	RolesClaim string
+}
+
+// NewAuthenticator returns a bearer token authenticator that accepts JWTs verified by v.
+// The principal's ID is the sub claim, its scopes come from the scope or scp claim and its
+// roles from the configured roles claim. The verified claims are available to handlers
+// through GetClaims.
+func NewAuthenticator(v *Verifier, opts AuthenticatorOptions) *auth.BearerToken {
+	if opts.RolesClaim == "" {
+		opts.RolesClaim = "roles"
+	}
+
+	return &auth.BearerToken{
+		Realm: opts.Realm,
+		Validate: func(ctx context.Context, token string) (*auth.Principal, error) {
+			claims, err := v.Verify(ctx, token)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", auth.ErrInvalidCredentials, err)
+			}
+
+			return &auth.Principal{
+				ID:         claims.Subject,
+				Scheme:     "Bearer",
+				Scopes:     claims.Scopes(),
+				Roles:      claims.StringSlice(opts.RolesClaim),
+				Attributes: map[string]any{claimsAttribute: claims},
+			}, nil
+		},
+	}
+}
+
+// GetClaims returns the verified JWT claims of the request's principal, if it was
+// authenticated by an authenticator from NewAuthenticator
+func GetClaims(ctx context.Context) (*Claims, bool) {
+	principal, ok := auth.GetPrincipal(ctx)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := principal.Attributes[claimsAttribute].(*Claims)
+	return claims, ok
+}
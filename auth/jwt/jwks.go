@@ -0,0 +1,297 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var logger = logx.Named("jwt")
+
+const (
+	// DefaultRefreshInterval is how often keys are refetched when JWKSOptions.RefreshInterval is zero
+	DefaultRefreshInterval = time.Hour
+	// DefaultMinRefreshInterval bounds on-demand refetches triggered by unknown key IDs
+	DefaultMinRefreshInterval = time.Minute
+
+	maxJWKSSize = 1 << 20
+)
+
+var _ KeySource = (*JWKS)(nil)
+
+// JWKSOptions configures a JWKS key source
+type JWKSOptions struct {
+	// Client performs the fetches. Defaults to a client with a 10 second timeout.
+	Client *http.Client
+	// RefreshInterval is how often keys are refetched in the background
+	RefreshInterval time.Duration
+	// MinRefreshInterval is the minimum time between fetches triggered by tokens signed
+	// with an unknown key ID, protecting the identity provider from floods of bogus tokens
+	MinRefreshInterval time.Duration
+}
+
+// JWK is a single JSON Web Key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type cachedKey struct {
+	alg string
+	key any
+}
+
+// JWKS is a KeySource that fetches keys from a JSON Web Key Set endpoint, caching them and
+// refreshing them periodically so that key rotation at the identity provider is picked up
+type JWKS struct {
+	url  string
+	opts JWKSOptions
+
+	mu          sync.RWMutex
+	keys        map[string]cachedKey
+	lastAttempt time.Time
+	refreshLock sync.Mutex
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewJWKS fetches the key set at url and starts refreshing it in the background until
+// ctx is cancelled or Close is called
+func NewJWKS(ctx context.Context, url string, opts JWKSOptions) (*JWKS, error) {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefaultRefreshInterval
+	}
+	if opts.MinRefreshInterval <= 0 {
+		opts.MinRefreshInterval = DefaultMinRefreshInterval
+	}
+
+	j := &JWKS{
+		url:  url,
+		opts: opts,
+		keys: map[string]cachedKey{},
+		done: make(chan struct{}),
+	}
+	if err := j.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, j.cancel = context.WithCancel(ctx)
+	go j.refreshLoop(ctx)
+	return j, nil
+}
+
+// Close stops the background refresh
+func (j *JWKS) Close() {
+	j.cancel()
+	<-j.done
+}
+
+// Key returns the cached key for the token's kid, refetching the key set once if the kid
+// is unknown and the last fetch attempt, successful or not, is older than MinRefreshInterval
+func (j *JWKS) Key(ctx context.Context, header Header) (any, error) {
+	if key, ok := j.lookup(header); ok {
+		return key.checkAlg(header.Alg)
+	}
+
+	j.refreshLock.Lock()
+	if key, ok := j.lookup(header); ok {
+		j.refreshLock.Unlock()
+		return key.checkAlg(header.Alg)
+	}
+	j.mu.RLock()
+	stale := time.Since(j.lastAttempt) >= j.opts.MinRefreshInterval
+	j.mu.RUnlock()
+	if stale {
+		if err := j.refresh(ctx); err != nil {
+			logger.Warn(ctx, "failed to refresh JWKS", logx.Err(err), slog.String("url", j.url))
+		}
+	}
+	j.refreshLock.Unlock()
+
+	if key, ok := j.lookup(header); ok {
+		return key.checkAlg(header.Alg)
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, header.Kid)
+}
+
+// Refresh fetches the key set immediately
+func (j *JWKS) Refresh(ctx context.Context) error {
+	j.refreshLock.Lock()
+	defer j.refreshLock.Unlock()
+	return j.refresh(ctx)
+}
+
+func (j *JWKS) lookup(header Header) (cachedKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if header.Kid != "" {
+		key, ok := j.keys[header.Kid]
+		return key, ok
+	}
+	// Tokens without a kid can only be matched when the set holds a single key
+	if len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	return cachedKey{}, false
+}
+
+func (j *JWKS) refreshLoop(ctx context.Context) {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.opts.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.Refresh(ctx); err != nil && ctx.Err() == nil {
+				logger.Warn(ctx, "failed to refresh JWKS, keeping cached keys", logx.Err(err), slog.String("url", j.url))
+			}
+		}
+	}
+}
+
+// refresh fetches and replaces the cached keys; callers must hold refreshLock
+func (j *JWKS) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	// Failed attempts count too, so an outage at the identity provider isn't met with a
+	// fetch per bogus token
+	j.mu.Lock()
+	j.lastAttempt = time.Now()
+	j.mu.Unlock()
+
+	resp, err := j.opts.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]cachedKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			logger.Warn(ctx, "skipping unusable JWK", logx.Err(err), slog.String("kid", jwk.Kid))
+			continue
+		}
+		keys[jwk.Kid] = cachedKey{alg: jwk.Alg, key: key}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contains no usable signing keys")
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+	return nil
+}
+
+func (k cachedKey) checkAlg(alg string) (any, error) {
+	if k.alg != "" && k.alg != alg {
+		return nil, fmt.Errorf("%w: key is for %s, token uses %s", ErrKeyNotFound, k.alg, alg)
+	}
+	return k.key, nil
+}
+
+// PublicKey decodes the key material of an RSA, P-256 EC or Ed25519 OKP key
+func (k JWK) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on curve P-256")
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
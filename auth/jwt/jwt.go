@@ -0,0 +1,322 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+	HS256 = "HS256"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token is expired")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+	ErrKeyNotFound      = errors.New("signing key not found")
+)
+
+// Header is the decoded JOSE header of a token
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Audience is the aud claim, which may be encoded as a single string or an array
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("aud must be a string or array of strings: %w", err)
+	}
+	*a = multiple
+	return nil
+}
+
+// NumericDate is a JWT timestamp in seconds since the Unix epoch
+type NumericDate struct {
+	time.Time
+}
+
+func (d *NumericDate) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("invalid numeric date: %w", err)
+	}
+	whole := int64(seconds)
+	d.Time = time.Unix(whole, int64((seconds-float64(whole))*float64(time.Second))).UTC()
+	return nil
+}
+
+func (d NumericDate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Unix())
+}
+
+// Claims holds the registered claims of a token along with every raw claim
+type Claims struct {
+	Issuer    string       `json:"iss,omitempty"`
+	Subject   string       `json:"sub,omitempty"`
+	Audience  Audience     `json:"aud,omitempty"`
+	ExpiresAt *NumericDate `json:"exp,omitempty"`
+	NotBefore *NumericDate `json:"nbf,omitempty"`
+	IssuedAt  *NumericDate `json:"iat,omitempty"`
+	ID        string       `json:"jti,omitempty"`
+
+	// Raw holds every claim in the payload, including private claims
+	Raw map[string]any `json:"-"`
+}
+
+// Scopes returns the scopes granted by the space-delimited scope claim or the scp array
+func (c *Claims) Scopes() []string {
+	if scope, ok := c.Raw["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return c.StringSlice("scp")
+}
+
+// StringSlice returns a claim holding an array of strings, or a single string
+func (c *Claims) StringSlice(name string) []string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// KeySource resolves the key used to verify a token
+type KeySource interface {
+	Key(ctx context.Context, header Header) (any, error)
+}
+
+// KeySourceFunc adapts a function to a KeySource
+type KeySourceFunc func(ctx context.Context, header Header) (any, error)
+
+func (f KeySourceFunc) Key(ctx context.Context, header Header) (any, error) {
+	return f(ctx, header)
+}
+
+// HMACSecret returns a KeySource for HS256 tokens signed with a shared secret
+func HMACSecret(secret []byte) KeySource {
+	return KeySourceFunc(func(context.Context, Header) (any, error) {
+		return secret, nil
+	})
+}
+
+// StaticKeys returns a KeySource that looks keys up by kid. The key stored under an empty
+// kid is used for tokens without one.
+func StaticKeys(keys map[string]any) KeySource {
+	return KeySourceFunc(func(_ context.Context, header Header) (any, error) {
+		if key, ok := keys[header.Kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("%w: kid %q", ErrKeyNotFound, header.Kid)
+	})
+}
+
+// Verifier validates token signatures and registered claims
+type Verifier struct {
+	Keys KeySource
+	// Algorithms restricts the accepted signing algorithms. Defaults to all supported ones.
+	Algorithms []string
+	// Issuer, when set, must equal the iss claim
+	Issuer string
+	// Audience, when set, must intersect the aud claim
+	Audience []string
+	// ClockSkew is the leeway applied to exp and nbf checks
+	ClockSkew time.Duration
+	// RequireExpiry rejects tokens without an exp claim
+	RequireExpiry bool
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Verify parses token, checks its signature against the key source and validates its claims
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header Header
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformed, err)
+	}
+	if !v.algorithmAllowed(header.Alg) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformed, err)
+	}
+
+	key, err := v.Keys.Key(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformed, err)
+	}
+	if err := decodeSegment(parts[1], &claims.Raw); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformed, err)
+	}
+
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) algorithmAllowed(alg string) bool {
+	allowed := v.Algorithms
+	if len(allowed) == 0 {
+		allowed = []string{RS256, ES256, EdDSA, HS256}
+	}
+	for _, a := range allowed {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Verifier) validateClaims(claims *Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	if claims.ExpiresAt == nil {
+		if v.RequireExpiry {
+			return fmt.Errorf("%w: missing exp claim", ErrExpired)
+		}
+	} else if now.After(claims.ExpiresAt.Add(v.ClockSkew)) {
+		return ErrExpired
+	}
+
+	if claims.NotBefore != nil && now.Add(v.ClockSkew).Before(claims.NotBefore.Time) {
+		return ErrNotYetValid
+	}
+
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return fmt.Errorf("%w: %q", ErrInvalidIssuer, claims.Issuer)
+	}
+
+	if len(v.Audience) > 0 && !intersects(v.Audience, claims.Audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+// verifySignature checks signature over signingInput, requiring the key type to match alg
+// so that a public key can never be misused as an HMAC secret
+func verifySignature(alg string, key any, signingInput, signature []byte) error {
+	digest := sha256.Sum256(signingInput)
+
+	switch alg {
+	case HS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: HS256 requires a []byte secret, got %T", ErrKeyNotFound, key)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return ErrInvalidSignature
+		}
+	case RS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: RS256 requires an RSA public key, got %T", ErrKeyNotFound, key)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+	case ES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: ES256 requires a P-256 public key, got %T", ErrKeyNotFound, key)
+		}
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	case EdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: EdDSA requires an Ed25519 public key, got %T", ErrKeyNotFound, key)
+		}
+		if !ed25519.Verify(pub, signingInput, signature) {
+			return ErrInvalidSignature
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func intersects(expected, actual []string) bool {
+	for _, e := range expected {
+		for _, a := range actual {
+			if e == a {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,466 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dfryer1193/mjolnir/auth"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(Header{Alg: alg, Kid: kid, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case RS256:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case ES256:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		if err == nil {
+			signature = make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+		}
+	case EdDSA:
+		signature = ed25519.Sign(key.(ed25519.PrivateKey), []byte(input))
+	}
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":   "https://issuer.example",
+		"sub":   "user-1",
+		"aud":   "api",
+		"exp":   testNow.Add(time.Hour).Unix(),
+		"nbf":   testNow.Add(-time.Minute).Unix(),
+		"scope": "read write",
+	}
+}
+
+func withClaim(name string, value any) map[string]any {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	secret := []byte("shared-secret")
+
+	keys := StaticKeys(map[string]any{
+		"rsa": &rsaKey.PublicKey,
+		"ec":  &ecKey.PublicKey,
+		"ed":  edPub,
+		"hs":  secret,
+	})
+	v := &Verifier{Keys: keys, Now: func() time.Time { return testNow }}
+
+	tests := []struct {
+		name string
+		alg  string
+		kid  string
+		key  any
+	}{
+		{name: "RS256", alg: RS256, kid: "rsa", key: rsaKey},
+		{name: "ES256", alg: ES256, kid: "ec", key: ecKey},
+		{name: "EdDSA", alg: EdDSA, kid: "ed", key: edPriv},
+		{name: "HS256", alg: HS256, kid: "hs", key: secret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := sign(t, tt.alg, tt.kid, tt.key, validClaims())
+
+			claims, err := v.Verify(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "user-1" {
+				t.Errorf("Subject = %q, want user-1", claims.Subject)
+			}
+
+			tampered := token[:len(token)-4] + "AAAA"
+			if _, err := v.Verify(context.Background(), tampered); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify(tampered) error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	v := &Verifier{
+		Keys: StaticKeys(map[string]any{"": &rsaKey.PublicKey}),
+		Now:  func() time.Time { return testNow },
+	}
+
+	// An attacker signing with the public key as an HMAC secret must not be accepted
+	token := sign(t, HS256, "", []byte("public-key-bytes"), validClaims())
+	if _, err := v.Verify(context.Background(), token); err == nil {
+		t.Error("expected HS256 token verified against RSA key to be rejected")
+	}
+
+	none := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x"}`)) + "."
+	if _, err := v.Verify(context.Background(), none); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Errorf("Verify(alg=none) error = %v, want ErrUnsupportedAlg", err)
+	}
+
+	restricted := &Verifier{Keys: HMACSecret([]byte("s")), Algorithms: []string{RS256}}
+	token = sign(t, HS256, "", []byte("s"), validClaims())
+	if _, err := restricted.Verify(context.Background(), token); !errors.Is(err, ErrUnsupportedAlg) {
+		t.Errorf("Verify() with disallowed alg error = %v, want ErrUnsupportedAlg", err)
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	secret := []byte("secret")
+
+	tests := []struct {
+		name          string
+		claims        map[string]any
+		requireExpiry bool
+		expectedErr   error
+	}{
+		{name: "valid", claims: validClaims()},
+		{name: "expired", claims: withClaim("exp", testNow.Add(-time.Minute).Unix()), expectedErr: ErrExpired},
+		{name: "expired within skew", claims: withClaim("exp", testNow.Add(-10*time.Second).Unix())},
+		{name: "not yet valid", claims: withClaim("nbf", testNow.Add(time.Minute).Unix()), expectedErr: ErrNotYetValid},
+		{name: "not yet valid within skew", claims: withClaim("nbf", testNow.Add(10*time.Second).Unix())},
+		{name: "wrong issuer", claims: withClaim("iss", "https://evil.example"), expectedErr: ErrInvalidIssuer},
+		{name: "wrong audience", claims: withClaim("aud", "other"), expectedErr: ErrInvalidAudience},
+		{name: "audience array", claims: withClaim("aud", []string{"other", "api"})},
+		{name: "missing exp allowed", claims: withClaim("exp", nil)},
+		{name: "missing exp required", claims: withClaim("exp", nil), requireExpiry: true, expectedErr: ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Verifier{
+				Keys:          HMACSecret(secret),
+				Issuer:        "https://issuer.example",
+				Audience:      []string{"api"},
+				ClockSkew:     30 * time.Second,
+				RequireExpiry: tt.requireExpiry,
+				Now:           func() time.Time { return testNow },
+			}
+
+			_, err := v.Verify(context.Background(), sign(t, HS256, "", secret, tt.claims))
+			if tt.expectedErr == nil && err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	v := &Verifier{Keys: HMACSecret([]byte("s"))}
+	for _, token := range []string{"", "a.b", "!!!.b.c", "e30.e30.!!!"} {
+		if _, err := v.Verify(context.Background(), token); err == nil {
+			t.Errorf("Verify(%q) expected error", token)
+		}
+	}
+}
+
+func TestClaimsHelpers(t *testing.T) {
+	claims := &Claims{Raw: map[string]any{
+		"scp":   []any{"a", "b"},
+		"roles": "admin",
+	}}
+
+	if got := claims.Scopes(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Scopes() = %v, want [a b]", got)
+	}
+	if got := claims.StringSlice("roles"); len(got) != 1 || got[0] != "admin" {
+		t.Errorf("StringSlice(roles) = %v, want [admin]", got)
+	}
+	if got := claims.StringSlice("missing"); got != nil {
+		t.Errorf("StringSlice(missing) = %v, want nil", got)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	v := &Verifier{Keys: HMACSecret(secret), Now: func() time.Time { return testNow }}
+
+	var claims *Claims
+	handler := auth.New(auth.Options{
+		Authenticators: []auth.Authenticator{NewAuthenticator(v, AuthenticatorOptions{Realm: "api"})},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = GetClaims(r.Context())
+		principal, _ := auth.GetPrincipal(r.Context())
+		if principal.ID != "user-1" || len(principal.Scopes) != 2 || len(principal.Roles) != 1 {
+			t.Errorf("unexpected principal %+v", principal)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, HS256, "", secret, withClaim("roles", []string{"admin"})))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if claims == nil || claims.Issuer != "https://issuer.example" {
+		t.Errorf("GetClaims() = %+v", claims)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, HS256, "", secret, withClaim("exp", testNow.Add(-time.Hour).Unix())))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for expired token, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("WWW-Authenticate"); got != `Bearer realm="api", error="invalid_token"` {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+}
+
+func jwkFor(t *testing.T, kid string, pub any) map[string]any {
+	t.Helper()
+	enc := base64.RawURLEncoding.EncodeToString
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]any{"kty": "RSA", "kid": kid, "alg": RS256, "use": "sig",
+			"n": enc(k.N.Bytes()), "e": enc(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return map[string]any{"kty": "EC", "kid": kid, "crv": "P-256", "x": enc(x), "y": enc(y)}
+	case ed25519.PublicKey:
+		return map[string]any{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": enc(k)}
+	}
+	t.Fatalf("unsupported key %T", pub)
+	return nil
+}
+
+type jwksServer struct {
+	*httptest.Server
+	keys    atomic.Value
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...map[string]any) *jwksServer {
+	s := &jwksServer{}
+	s.keys.Store(keys)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": s.keys.Load()})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	server := newJWKSServer(t,
+		jwkFor(t, "rsa-1", &rsaKey.PublicKey),
+		jwkFor(t, "ec-1", &ecKey.PublicKey),
+		jwkFor(t, "ed-1", edPub),
+		map[string]any{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	)
+
+	jwks, err := NewJWKS(context.Background(), server.URL, JWKSOptions{})
+	if err != nil {
+		t.Fatalf("NewJWKS() error = %v", err)
+	}
+	defer jwks.Close()
+
+	v := &Verifier{Keys: jwks, Now: func() time.Time { return testNow }}
+	for _, token := range []string{
+		sign(t, RS256, "rsa-1", rsaKey, validClaims()),
+		sign(t, ES256, "ec-1", ecKey, validClaims()),
+		sign(t, EdDSA, "ed-1", edPriv, validClaims()),
+	} {
+		if _, err := v.Verify(context.Background(), token); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	}
+
+	// The key is pinned to RS256 by its alg member
+	if _, err := jwks.Key(context.Background(), Header{Alg: "RS384", Kid: "rsa-1"}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key() with mismatched alg error = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := jwks.Key(context.Background(), Header{Alg: RS256, Kid: "enc-1"}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Key() for encryption key error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, jwkFor(t, "old", &oldKey.PublicKey))
+
+	jwks, err := NewJWKS(context.Background(), server.URL, JWKSOptions{MinRefreshInterval: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("NewJWKS() error = %v", err)
+	}
+	defer jwks.Close()
+
+	v := &Verifier{Keys: jwks, Now: func() time.Time { return testNow }}
+	server.keys.Store([]map[string]any{jwkFor(t, "new", &newKey.PublicKey)})
+
+	// An unknown kid triggers an on-demand refresh that picks up the rotated key
+	if _, err := v.Verify(context.Background(), sign(t, RS256, "new", newKey, validClaims())); err != nil {
+		t.Fatalf("Verify() with rotated key error = %v", err)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, RS256, "old", oldKey, validClaims())); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Verify() with retired key error = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestJWKSUnknownKidRefreshIsRateLimited(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, jwkFor(t, "k1", &key.PublicKey))
+
+	jwks, err := NewJWKS(context.Background(), server.URL, JWKSOptions{MinRefreshInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewJWKS() error = %v", err)
+	}
+	defer jwks.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := jwks.Key(context.Background(), Header{Alg: RS256, Kid: "bogus"}); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Key() error = %v, want ErrKeyNotFound", err)
+		}
+	}
+	if got := server.fetches.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+}
+
+// outageTransport counts requests and fails those made while down, simulating an outage
+// at the identity provider
+type outageTransport struct {
+	down     atomic.Bool
+	attempts atomic.Int32
+}
+
+func (t *outageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.attempts.Add(1)
+	if t.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestJWKSFailedRefreshIsRateLimited(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, jwkFor(t, "k1", &key.PublicKey))
+	transport := &outageTransport{}
+
+	jwks, err := NewJWKS(context.Background(), server.URL, JWKSOptions{
+		Client:             &http.Client{Transport: transport},
+		MinRefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewJWKS() error = %v", err)
+	}
+	defer jwks.Close()
+
+	// The first unknown kid is fetched for, and fails, while later ones are throttled
+	transport.down.Store(true)
+	jwks.mu.Lock()
+	jwks.lastAttempt = time.Time{}
+	jwks.mu.Unlock()
+	for i := 0; i < 5; i++ {
+		if _, err := jwks.Key(context.Background(), Header{Alg: RS256, Kid: "bogus"}); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Key() error = %v, want ErrKeyNotFound", err)
+		}
+	}
+	if got := transport.attempts.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", got)
+	}
+	if _, err := jwks.Key(context.Background(), Header{Alg: RS256, Kid: "k1"}); err != nil {
+		t.Errorf("Key() for cached kid error = %v", err)
+	}
+}
+
+func TestJWKSBackgroundRefresh(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, jwkFor(t, "old", &oldKey.PublicKey))
+
+	jwks, err := NewJWKS(context.Background(), server.URL, JWKSOptions{
+		RefreshInterval:    10 * time.Millisecond,
+		MinRefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewJWKS() error = %v", err)
+	}
+	defer jwks.Close()
+
+	server.keys.Store([]map[string]any{jwkFor(t, "new", &newKey.PublicKey)})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := jwks.Key(context.Background(), Header{Alg: RS256, Kid: "new"}); err == nil {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("background refresh did not pick up the rotated key")
+}
+
+func TestNewJWKSFailsWithoutKeys(t *testing.T) {
+	server := newJWKSServer(t)
+	if _, err := NewJWKS(context.Background(), server.URL, JWKSOptions{}); err == nil {
+		t.Error("expected error for empty key set")
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if _, err := NewJWKS(context.Background(), failing.URL, JWKSOptions{}); err == nil {
+		t.Error("expected error for failing endpoint")
+	}
+}
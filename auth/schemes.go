@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	_ Authenticator = (*BearerToken)(nil)
+	_ Authenticator = (*BasicAuth)(nil)
+	_ Authenticator = (*APIKey)(nil)
+)
+
+// BearerToken authenticates requests carrying an `Authorization: Bearer <token>` header
+type BearerToken struct {
+	Realm string
+	// Validate resolves the principal for a token
+	Validate func(ctx context.Context, token string) (*Principal, error)
+}
+
+func (b *BearerToken) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := authorizationCredentials(r, "Bearer")
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%w: empty bearer token", ErrInvalidCredentials)
+	}
+
+	principal, err := b.Validate(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	return withScheme(principal, "Bearer"), nil
+}
+
+func (b *BearerToken) Challenge(err error) string {
+	challenge := "Bearer" + realmParam(b.Realm)
+	if err != nil {
+		challenge += sep(b.Realm) + `error="invalid_token"`
+	}
+	return challenge
+}
+
+// BasicAuth authenticates requests using HTTP Basic credentials
+type BasicAuth struct {
+	Realm string
+	// Verify resolves the principal for a username and password
+	Verify func(ctx context.Context, username, password string) (*Principal, error)
+}
+
+func (b *BasicAuth) Authenticate(r *http.Request) (*Principal, error) {
+	if _, ok := authorizationCredentials(r, "Basic"); !ok {
+		return nil, ErrNoCredentials
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed basic credentials", ErrInvalidCredentials)
+	}
+
+	principal, err := b.Verify(r.Context(), username, password)
+	if err != nil {
+		return nil, err
+	}
+	return withScheme(principal, "Basic"), nil
+}
+
+func (b *BasicAuth) Challenge(error) string {
+	return "Basic" + realmParam(b.Realm) + sep(b.Realm) + `charset="UTF-8"`
+}
+
+// APIKey authenticates requests carrying a key in a header or query parameter
+type APIKey struct {
+	Realm string
+	// Header is the name of the header holding the key, such as X-API-Key
+	Header string
+	// Query is the name of the query parameter holding the key. Keys in URLs tend to end
+	// up in logs and browser history, so prefer Header where possible.
+	Query string
+	// Lookup resolves the principal owning a key
+	Lookup func(ctx context.Context, key string) (*Principal, error)
+}
+
+func (a *APIKey) Authenticate(r *http.Request) (*Principal, error) {
+	var key string
+	if a.Header != "" {
+		key = r.Header.Get(a.Header)
+	}
+	if key == "" && a.Query != "" {
+		key = r.URL.Query().Get(a.Query)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	principal, err := a.Lookup(r.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	return withScheme(principal, "APIKey"), nil
+}
+
+func (a *APIKey) Challenge(error) string {
+	return "APIKey" + realmParam(a.Realm)
+}
+
+// StaticAPIKeys returns an APIKey lookup function backed by a fixed set of keys. Keys are
+// compared in constant time.
+func StaticAPIKeys(keys map[string]Principal) func(ctx context.Context, key string) (*Principal, error) {
+	hashed := make(map[[sha256.Size]byte]Principal, len(keys))
+	for k, p := range keys {
+		hashed[sha256.Sum256([]byte(k))] = p
+	}
+
+	return func(_ context.Context, key string) (*Principal, error) {
+		sum := sha256.Sum256([]byte(key))
+		var match *Principal
+		for candidate, p := range hashed {
+			if subtle.ConstantTimeCompare(candidate[:], sum[:]) == 1 {
+				principal := p
+				match = &principal
+			}
+		}
+		if match == nil {
+			return nil, ErrInvalidCredentials
+		}
+		return match, nil
+	}
+}
+
+// withScheme returns a copy of principal with its scheme defaulted, leaving the caller's
+// value untouched in case it is shared
+func withScheme(principal *Principal, scheme string) *Principal {
+	if principal == nil || principal.Scheme != "" {
+		return principal
+	}
+	p := *principal
+	p.Scheme = scheme
+	return &p
+}
+
+// authorizationCredentials returns the credentials of an Authorization header using scheme
+func authorizationCredentials(r *http.Request, scheme string) (string, bool) {
+	header := r.Header.Get("Authorization")
+	prefix, credentials, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(prefix, scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(credentials), true
+}
+
+func realmParam(realm string) string {
+	if realm == "" {
+		return ""
+	}
+	return fmt.Sprintf(" realm=%q", realm)
+}
+
+// sep returns the separator between the realm parameter and any further parameters
+func sep(realm string) string {
+	if realm == "" {
+		return " "
+	}
+	return ", "
+}
@@ -3,8 +3,10 @@ module github.com/dfryer1193/mjolnir
 go 1.23
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/go-chi/chi/v5 v5.2.1
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	github.com/rs/zerolog v1.33.0
 )
 
@@ -0,0 +1,245 @@
+package accesslog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var logger = logx.Named("accesslog")
+
+// Options configures a Logger
+type Options struct {
+	// Writer receives one line per request. Defaults to os.Stdout; use OpenFile for a file
+	// that can be reopened after rotation.
+	Writer io.Writer
+	// Format renders each line. Defaults to Combined.
+	Format Format
+	// Async queues lines and writes them from a background goroutine through a buffer, so
+	// that slow disks do not hold up responses. Lines are dropped when the queue is full.
+	Async bool
+	// QueueSize is the number of lines an async Logger queues. Defaults to 1024.
+	QueueSize int
+	// FlushInterval is how often an async Logger flushes its buffer. Defaults to one second.
+	FlushInterval time.Duration
+}
+
+// Logger writes an access log line for every request it handles
+type Logger struct {
+	opts Options
+	now  func() time.Time
+
+	// writeMu serializes writes in synchronous mode and after Close
+	writeMu sync.Mutex
+	failing atomic.Bool
+	dropped atomic.Uint64
+
+	// mu guards closed so that no line is queued after the queue is closed
+	mu     sync.RWMutex
+	closed bool
+	lines  chan []byte
+	done   chan struct{}
+}
+
+// NewLogger returns a Logger. Async loggers must be closed to flush buffered lines.
+func NewLogger(opts Options) *Logger {
+	if opts.Writer == nil {
+		opts.Writer = os.Stdout
+	}
+	if opts.Format == nil {
+		opts.Format = Combined
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+
+	l := &Logger{opts: opts, now: time.Now}
+	if opts.Async {
+		l.lines = make(chan []byte, opts.QueueSize)
+		l.done = make(chan struct{})
+		go l.run()
+	}
+	return l
+}
+
+// New returns a synchronous access log middleware. Use NewLogger for an async Logger so
+// that it can be closed on shutdown.
+func New(opts Options) func(http.Handler) http.Handler {
+	opts.Async = false
+	return NewLogger(opts).Handler
+}
+
+// Handler is the access log middleware. It should run inside RequestID and
+// TrustedProxies so that lines carry the request ID and real client address.
+func (l *Logger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := l.now()
+		ww := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			if p := recover(); p != nil {
+				// The recoverer further out answers with a 500 unless the handler already
+				// wrote a response
+				if !ww.wroteHeader {
+					ww.status = http.StatusInternalServerError
+				}
+				l.log(r, ww, start)
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(ww, r)
+		l.log(r, ww, start)
+	})
+}
+
+func (l *Logger) log(r *http.Request, ww *statusWriter, start time.Time) {
+	redactor := middleware.GetRedactor()
+	e := &Entry{
+		Time:           start,
+		Duration:       l.now().Sub(start),
+		RequestID:      middleware.GetRequestID(r.Context()),
+		ClientIP:       middleware.ClientIP(r),
+		User:           user(r),
+		Method:         r.Method,
+		Path:           r.URL.EscapedPath(),
+		Query:          middleware.RedactQuery(redactor, r.URL.RawQuery),
+		Proto:          r.Proto,
+		Host:           r.Host,
+		Status:         ww.status,
+		Bytes:          ww.bytes,
+		RequestHeader:  middleware.RedactHeaders(redactor, r.Header),
+		ResponseHeader: middleware.RedactHeaders(redactor, ww.Header()),
+	}
+
+	line := l.opts.Format.Append(make([]byte, 0, 256), e)
+	line = append(line, '\n')
+
+	l.mu.RLock()
+	if !l.closed && l.lines != nil {
+		select {
+		case l.lines <- line:
+		default:
+			l.dropped.Add(1)
+		}
+		l.mu.RUnlock()
+		return
+	}
+	l.mu.RUnlock()
+
+	l.writeMu.Lock()
+	_, err := l.opts.Writer.Write(line)
+	l.writeMu.Unlock()
+	l.report(err)
+}
+
+// user returns the authenticated principal recorded in the request log, falling back to
+// the basic auth user name
+func user(r *http.Request) string {
+	if principal, ok := middleware.GetLogField(r.Context(), "principal"); ok {
+		return fmt.Sprint(principal)
+	}
+	if name, _, ok := r.BasicAuth(); ok {
+		return name
+	}
+	return ""
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+
+	buf := bufio.NewWriterSize(l.opts.Writer, 64<<10)
+	ticker := time.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-l.lines:
+			if !ok {
+				l.report(buf.Flush())
+				return
+			}
+			_, err := buf.Write(line)
+			l.report(err)
+		case <-ticker.C:
+			l.report(buf.Flush())
+		}
+	}
+}
+
+// report logs the first of a run of write errors, so that a full disk does not flood the
+// application log
+func (l *Logger) report(err error) {
+	if err == nil {
+		l.failing.Store(false)
+		return
+	}
+	if !l.failing.Swap(true) {
+		logger.Error(context.Background(), "failed to write access log", logx.Err(err))
+	}
+}
+
+// Dropped returns the number of lines an async Logger dropped because its queue was full
+func (l *Logger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close flushes queued lines and stops the background writer. Lines logged after Close
+// are written synchronously. It does not close the Writer.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	if l.closed || l.lines == nil {
+		l.closed = true
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.lines)
+	l.mu.Unlock()
+
+	<-l.done
+	return nil
+}
+
+// statusWriter records the status and size of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(statusCode int) {
+	if !sw.wroteHeader {
+		sw.status = statusCode
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+func (sw *statusWriter) Flush() {
+	sw.wroteHeader = true
+	http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
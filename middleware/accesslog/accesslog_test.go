@@ -0,0 +1,304 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testEntry() *Entry {
+	reqHeader := http.Header{}
+	reqHeader.Set("Referer", "https://example.com/")
+	reqHeader.Set("User-Agent", `curl/8.0 "quoted"`)
+	respHeader := http.Header{}
+	respHeader.Set("Content-Type", "text/plain")
+
+	return &Entry{
+		Time:           time.Date(2024, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		Duration:       1500 * time.Millisecond,
+		RequestID:      "req-1",
+		ClientIP:       "127.0.0.1",
+		User:           "frank",
+		Method:         http.MethodGet,
+		Path:           "/apache_pb.gif",
+		Query:          "a=1",
+		Proto:          "HTTP/1.0",
+		Host:           "example.com",
+		Status:         http.StatusOK,
+		Bytes:          2326,
+		RequestHeader:  reqHeader,
+		ResponseHeader: respHeader,
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		entry    func(e *Entry)
+		expected string
+	}{
+		{
+			name:     "common",
+			format:   Common,
+			expected: `127.0.0.1 - frank [10/Oct/2024:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 2326`,
+		},
+		{
+			name:     "combined escapes quotes",
+			format:   Combined,
+			expected: `127.0.0.1 - frank [10/Oct/2024:13:55:36 -0700] "GET /apache_pb.gif?a=1 HTTP/1.0" 200 2326 "https://example.com/" "curl/8.0 \"quoted\""`,
+		},
+		{
+			name:     "empty values are dashes",
+			format:   Common,
+			entry:    func(e *Entry) { e.User, e.Bytes, e.Query = "", 0, "" },
+			expected: `127.0.0.1 - - [10/Oct/2024:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 -`,
+		},
+		{
+			name:     "template directives",
+			format:   MustTemplate(`%m %U%q %>s %B %D %T %v %L %{content-type}o 100%%`),
+			expected: `GET /apache_pb.gif?a=1 200 2326 1500000 1 example.com req-1 text/plain 100%`,
+		},
+		{
+			name:     "control characters are escaped",
+			format:   MustTemplate(`%u`),
+			entry:    func(e *Entry) { e.User = "evil\n127.0.0.1" },
+			expected: `evil\x0a127.0.0.1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEntry()
+			if tt.entry != nil {
+				tt.entry(e)
+			}
+			if got := string(tt.format.Append(nil, e)); got != tt.expected {
+				t.Errorf("got  %s\nwant %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewTemplateErrors(t *testing.T) {
+	for _, tmpl := range []string{"%", "%z", "%>b", "%{Referer", "%{Referer}x"} {
+		if _, err := NewTemplate(tmpl); err == nil {
+			t.Errorf("NewTemplate(%q) expected an error", tmpl)
+		}
+	}
+}
+
+func TestECS(t *testing.T) {
+	line := ECS.Append(nil, testEntry())
+
+	var got map[string]any
+	if err := json.Unmarshal(line, &got); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, line)
+	}
+	if got["@timestamp"] != "2024-10-10T20:55:36Z" {
+		t.Errorf("@timestamp = %v", got["@timestamp"])
+	}
+	expected := map[string]any{
+		"http.request.method":       "GET",
+		"http.response.status_code": float64(200),
+		"http.response.body.bytes":  float64(2326),
+		"http.version":              "1.0",
+		"url.original":              "/apache_pb.gif?a=1",
+		"client.ip":                 "127.0.0.1",
+		"user.name":                 "frank",
+		"event.duration":            float64(1500 * time.Millisecond),
+		"event.outcome":             "success",
+		"user_agent.original":       `curl/8.0 "quoted"`,
+		"http.request.id":           "req-1",
+		"http.request.referrer":     "https://example.com/",
+		"ecs.version":               ecsVersion,
+		"url.domain":                "example.com",
+		"url.query":                 "a=1",
+		"url.path":                  "/apache_pb.gif",
+		"event.kind":                "event",
+	}
+	for path, want := range expected {
+		var v any = got
+		for _, key := range strings.Split(path, ".") {
+			m, _ := v.(map[string]any)
+			v = m[key]
+		}
+		if v != want {
+			t.Errorf("%s = %v, want %v", path, v, want)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := middleware.RequestID(middleware.RequestLogger(New(Options{Writer: &buf, Format: Combined})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middleware.SetLogField(r.Context(), "principal", "alice")
+			w.Header().Set("Set-Cookie", "session=secret")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("hello"))
+		}),
+	)))
+
+	req := httptest.NewRequest(http.MethodPost, "/items?token=abc&page=2", nil)
+	req.Header.Set("User-Agent", "test")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	for _, expected := range []string{
+		"192.0.2.1 - alice [",
+		`"POST /items?page=2&token=%5BREDACTED%5D HTTP/1.1" 201 5 "-" "test"`,
+	} {
+		if !strings.Contains(line, expected) {
+			t.Errorf("line doesn't contain %q\nLine: %s", expected, line)
+		}
+	}
+	if strings.Contains(line, "abc") {
+		t.Errorf("line leaks a secret\nLine: %s", line)
+	}
+	if !strings.HasSuffix(line, "\n") || strings.Count(line, "\n") != 1 {
+		t.Errorf("expected exactly one line, got %q", line)
+	}
+}
+
+func TestLoggerPanic(t *testing.T) {
+	var buf bytes.Buffer
+	handler := New(Options{Writer: &buf, Format: MustTemplate("%>s")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected the panic to propagate")
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	if buf.String() != "500\n" {
+		t.Errorf("line = %q, want 500", buf.String())
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for the async writer and the test to share
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLoggerAsync(t *testing.T) {
+	var out lockedBuffer
+	logger := NewLogger(Options{Writer: &out, Format: MustTemplate("%U"), Async: true, FlushInterval: time.Hour})
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if out.String() != "" {
+		t.Errorf("expected lines to be buffered, got %q", out.String())
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if out.String() != "/a\n/b\n/c\n" {
+		t.Errorf("output = %q", out.String())
+	}
+
+	// Lines logged after Close are written directly
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/d", nil))
+	if !strings.HasSuffix(out.String(), "/d\n") {
+		t.Errorf("output = %q", out.String())
+	}
+	if logger.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", logger.Dropped())
+	}
+}
+
+// blockingWriter holds up the async writer until released
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestLoggerAsyncDrops(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	logger := NewLogger(Options{Writer: w, Format: MustTemplate(strings.Repeat("x", 70<<10)), Async: true, QueueSize: 1})
+	handler := logger.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Lines larger than the buffer reach the writer immediately, so the first blocks the
+	// background goroutine, the second fills the queue and the rest are dropped
+	deadline := time.Now().Add(5 * time.Second)
+	for logger.Dropped() == 0 && time.Now().Before(deadline) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if logger.Dropped() == 0 {
+		t.Error("expected lines to be dropped while the writer is blocked")
+	}
+
+	close(w.release)
+	logger.Close()
+}
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("second\n"))
+	if err := f.Reopen(); err != nil {
+		t.Fatalf("Reopen() error = %v", err)
+	}
+	f.Write([]byte("third\n"))
+
+	rotated, _ := os.ReadFile(path + ".1")
+	if string(rotated) != "first\nsecond\n" {
+		t.Errorf("rotated file = %q", rotated)
+	}
+	current, _ := os.ReadFile(path)
+	if string(current) != "third\n" {
+		t.Errorf("current file = %q", current)
+	}
+
+	f.Close()
+	if _, err := f.Write([]byte("late\n")); err == nil {
+		t.Error("expected write after Close to fail")
+	}
+	if err := f.Reopen(); err == nil {
+		t.Error("expected Reopen after Close to fail")
+	}
+}
@@ -0,0 +1,107 @@
+package accesslog
+
+import (
+	"context"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// File is an append-only log file that can be reopened after external rotation, such as
+// by logrotate, without restarting the process
+type File struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFile opens path for appending, creating it if needed
+func OpenFile(path string) (*File, error) {
+	f, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+	return &File{path: path, f: f}, nil
+}
+
+func openAppend(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return 0, os.ErrClosed
+	}
+	return f.f.Write(p)
+}
+
+// Reopen closes the file and opens path again, picking up a new file after rotation. The
+// current file is kept if path cannot be opened.
+func (f *File) Reopen() error {
+	next, err := openAppend(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	prev := f.f
+	if prev == nil {
+		f.mu.Unlock()
+		next.Close()
+		return os.ErrClosed
+	}
+	f.f = next
+	f.mu.Unlock()
+
+	return prev.Close()
+}
+
+// ReopenOn reopens the file whenever the process receives one of sigs, SIGHUP by default.
+// The returned function stops listening.
+func (f *File) ReopenOn(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if err := f.Reopen(); err != nil {
+					logger.Error(context.Background(), "failed to reopen access log", logx.Err(err), slog.String("path", f.path))
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// Close closes the file. Writes after Close fail with os.ErrClosed.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.f == nil {
+		return nil
+	}
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
@@ -0,0 +1,322 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry describes a completed request
+type Entry struct {
+	// Time is when the request was received
+	Time      time.Time
+	Duration  time.Duration
+	RequestID string
+	ClientIP  string
+	// User is the authenticated user, if any
+	User   string
+	Method string
+	// Path is the request path and Query its redacted query string
+	Path           string
+	Query          string
+	Proto          string
+	Host           string
+	Status         int
+	Bytes          int64
+	RequestHeader  http.Header
+	ResponseHeader http.Header
+}
+
+// Format renders an entry as a single log line, without the trailing newline
+type Format interface {
+	Append(dst []byte, e *Entry) []byte
+}
+
+// FormatFunc adapts a function to Format
+type FormatFunc func(dst []byte, e *Entry) []byte
+
+func (f FormatFunc) Append(dst []byte, e *Entry) []byte {
+	return f(dst, e)
+}
+
+const (
+	// CommonTemplate is the Apache Common Log Format
+	CommonTemplate = `%h %l %u %t "%r" %>s %b`
+	// CombinedTemplate is the Apache Combined Log Format
+	CombinedTemplate = CommonTemplate + ` "%{Referer}i" "%{User-Agent}i"`
+)
+
+var (
+	// Common writes the Apache Common Log Format
+	Common = MustTemplate(CommonTemplate)
+	// Combined writes the Apache Combined Log Format
+	Combined = MustTemplate(CombinedTemplate)
+	// ECS writes Elastic Common Schema JSON
+	ECS Format = FormatFunc(appendECS)
+)
+
+// Template is a Format built from Apache mod_log_config style directives:
+//
+//	%h client IP         %l always "-"            %u user
+//	%t receive time      %r request line          %s, %>s status
+//	%b bytes or "-"      %B bytes                 %D duration in microseconds
+//	%T duration in secs  %m method                %U path
+//	%q query with "?"    %H protocol              %v host
+//	%L request ID        %{Name}i request header  %{Name}o response header
+//	%% a literal "%"
+//
+// Values that may come from the client are escaped as Apache does. Logger redacts headers
+// and query parameters before they reach a Format.
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	literal   string
+	directive byte
+	header    string
+}
+
+// NewTemplate parses an access log template
+func NewTemplate(tmpl string) (*Template, error) {
+	t := &Template{}
+	var literal strings.Builder
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '%' {
+			literal.WriteByte(tmpl[i])
+			continue
+		}
+		i++
+		if i >= len(tmpl) {
+			return nil, fmt.Errorf("accesslog: template ends with %%")
+		}
+
+		part := templatePart{}
+		switch c := tmpl[i]; c {
+		case '%':
+			literal.WriteByte('%')
+			continue
+		case '>':
+			if i+1 >= len(tmpl) || tmpl[i+1] != 's' {
+				return nil, fmt.Errorf("accesslog: unsupported directive %%>%s", tmpl[i+1:min(i+2, len(tmpl))])
+			}
+			i++
+			part.directive = 's'
+		case '{':
+			end := strings.IndexByte(tmpl[i:], '}')
+			if end < 0 || i+end+1 >= len(tmpl) {
+				return nil, fmt.Errorf("accesslog: unterminated %%{ directive")
+			}
+			part.header = http.CanonicalHeaderKey(tmpl[i+1 : i+end])
+			i += end + 1
+			part.directive = tmpl[i]
+			if part.directive != 'i' && part.directive != 'o' {
+				return nil, fmt.Errorf("accesslog: unsupported directive %%{%s}%c", part.header, part.directive)
+			}
+		case 'h', 'l', 'u', 't', 'r', 's', 'b', 'B', 'D', 'T', 'm', 'U', 'q', 'H', 'v', 'L':
+			part.directive = c
+		default:
+			return nil, fmt.Errorf("accesslog: unsupported directive %%%c", c)
+		}
+
+		if literal.Len() > 0 {
+			t.parts = append(t.parts, templatePart{literal: literal.String()})
+			literal.Reset()
+		}
+		t.parts = append(t.parts, part)
+	}
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: literal.String()})
+	}
+	return t, nil
+}
+
+// MustTemplate is like NewTemplate but panics if the template is invalid
+func MustTemplate(tmpl string) *Template {
+	t, err := NewTemplate(tmpl)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t *Template) Append(dst []byte, e *Entry) []byte {
+	for _, p := range t.parts {
+		if p.directive == 0 {
+			dst = append(dst, p.literal...)
+			continue
+		}
+		switch p.directive {
+		case 'h':
+			dst = appendOrDash(dst, e.ClientIP)
+		case 'l':
+			dst = append(dst, '-')
+		case 'u':
+			dst = appendEscaped(dst, e.User)
+		case 't':
+			dst = append(dst, '[')
+			dst = e.Time.AppendFormat(dst, "02/Jan/2006:15:04:05 -0700")
+			dst = append(dst, ']')
+		case 'r':
+			dst = appendEscaped(dst, e.Method)
+			dst = append(dst, ' ')
+			dst = appendEscaped(dst, e.uri())
+			dst = append(dst, ' ')
+			dst = appendEscaped(dst, e.Proto)
+		case 's':
+			dst = strconv.AppendInt(dst, int64(e.Status), 10)
+		case 'b':
+			if e.Bytes == 0 {
+				dst = append(dst, '-')
+			} else {
+				dst = strconv.AppendInt(dst, e.Bytes, 10)
+			}
+		case 'B':
+			dst = strconv.AppendInt(dst, e.Bytes, 10)
+		case 'D':
+			dst = strconv.AppendInt(dst, e.Duration.Microseconds(), 10)
+		case 'T':
+			dst = strconv.AppendInt(dst, int64(e.Duration/time.Second), 10)
+		case 'm':
+			dst = appendEscaped(dst, e.Method)
+		case 'U':
+			dst = appendEscaped(dst, e.Path)
+		case 'q':
+			if e.Query != "" {
+				dst = append(dst, '?')
+				dst = appendEscaped(dst, e.Query)
+			}
+		case 'H':
+			dst = appendEscaped(dst, e.Proto)
+		case 'v':
+			dst = appendEscaped(dst, e.Host)
+		case 'L':
+			dst = appendOrDash(dst, e.RequestID)
+		case 'i':
+			dst = appendEscaped(dst, strings.Join(e.RequestHeader.Values(p.header), ", "))
+		case 'o':
+			dst = appendEscaped(dst, strings.Join(e.ResponseHeader.Values(p.header), ", "))
+		}
+	}
+	return dst
+}
+
+func (e *Entry) uri() string {
+	if e.Query == "" {
+		return e.Path
+	}
+	return e.Path + "?" + e.Query
+}
+
+func appendOrDash(dst []byte, s string) []byte {
+	if s == "" {
+		return append(dst, '-')
+	}
+	return append(dst, s...)
+}
+
+// appendEscaped writes s with quotes, backslashes and non-printable bytes escaped, as Apache
+// does, so that clients cannot forge log lines. Empty values are written as "-".
+func appendEscaped(dst []byte, s string) []byte {
+	if s == "" {
+		return append(dst, '-')
+	}
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c < 0x20 || c >= 0x7f:
+			dst = append(dst, '\\', 'x', hex[c>>4], hex[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
+
+// ecsVersion is the Elastic Common Schema version the ECS format follows
+const ecsVersion = "8.11.0"
+
+type ecsEntry struct {
+	Timestamp string `json:"@timestamp"`
+	ECS       struct {
+		Version string `json:"version"`
+	} `json:"ecs"`
+	Event struct {
+		Kind     string   `json:"kind"`
+		Category []string `json:"category"`
+		Type     []string `json:"type"`
+		Outcome  string   `json:"outcome"`
+		Duration int64    `json:"duration"`
+	} `json:"event"`
+	HTTP struct {
+		Version string `json:"version,omitempty"`
+		Request struct {
+			ID       string `json:"id,omitempty"`
+			Method   string `json:"method"`
+			Referrer string `json:"referrer,omitempty"`
+		} `json:"request"`
+		Response struct {
+			StatusCode int `json:"status_code"`
+			Body       struct {
+				Bytes int64 `json:"bytes"`
+			} `json:"body"`
+		} `json:"response"`
+	} `json:"http"`
+	URL struct {
+		Domain   string `json:"domain,omitempty"`
+		Path     string `json:"path"`
+		Query    string `json:"query,omitempty"`
+		Original string `json:"original"`
+	} `json:"url"`
+	Client struct {
+		IP string `json:"ip,omitempty"`
+	} `json:"client"`
+	UserAgent struct {
+		Original string `json:"original,omitempty"`
+	} `json:"user_agent"`
+	User *struct {
+		Name string `json:"name"`
+	} `json:"user,omitempty"`
+}
+
+func appendECS(dst []byte, e *Entry) []byte {
+	var out ecsEntry
+	out.Timestamp = e.Time.UTC().Format(time.RFC3339Nano)
+	out.ECS.Version = ecsVersion
+	out.Event.Kind = "event"
+	out.Event.Category = []string{"web"}
+	out.Event.Type = []string{"access"}
+	out.Event.Outcome = "success"
+	if e.Status >= http.StatusBadRequest {
+		out.Event.Outcome = "failure"
+	}
+	out.Event.Duration = e.Duration.Nanoseconds()
+	out.HTTP.Version = strings.TrimPrefix(e.Proto, "HTTP/")
+	out.HTTP.Request.ID = e.RequestID
+	out.HTTP.Request.Method = e.Method
+	out.HTTP.Request.Referrer = e.RequestHeader.Get("Referer")
+	out.HTTP.Response.StatusCode = e.Status
+	out.HTTP.Response.Body.Bytes = e.Bytes
+	out.URL.Domain = e.Host
+	out.URL.Path = e.Path
+	out.URL.Query = e.Query
+	out.URL.Original = e.uri()
+	out.Client.IP = e.ClientIP
+	out.UserAgent.Original = e.RequestHeader.Get("User-Agent")
+	if e.User != "" {
+		out.User = &struct {
+			Name string `json:"name"`
+		}{Name: e.User}
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		return dst
+	}
+	return append(dst, b...)
+}
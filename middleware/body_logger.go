@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultBodyLogHeader forces body logging for a request when BodyLogOptions.Authorize
+// accepts its value
+const DefaultBodyLogHeader = "X-Debug-Body"
+
+// DefaultBodyLogContentTypes are the media types whose bodies are logged by default: those
+// that can be parsed for redaction
+var DefaultBodyLogContentTypes = []string{
+	"application/json",
+	"application/*+json",
+	"application/x-www-form-urlencoded",
+}
+
+// BodyLogOptions configures the body logging middleware
+type BodyLogOptions struct {
+	// MaxBytes is the most captured from each body. Defaults to 4 KiB.
+	MaxBytes int
+	// Routes limits logging to requests whose chi route pattern, or path when no route
+	// matched, matches one of these path.Match patterns. All routes are logged when empty.
+	Routes []string
+	// Statuses limits logging to responses with these status codes
+	Statuses []int
+	// MinStatus limits logging to responses with at least this status, such as 400 for
+	// failed requests only. It is combined with Statuses as either-or.
+	MinStatus int
+	// SampleRate logs this fraction of matching requests. Zero logs all of them.
+	SampleRate float64
+	// DebugHeader names the request header that forces logging regardless of the rules
+	// above. Defaults to DefaultBodyLogHeader.
+	DebugHeader string
+	// Authorize decides whether a request may force logging with DebugHeader, given the
+	// header value. The header is ignored unless it is set; loglevel.Tokens covers the
+	// common case.
+	Authorize func(r *http.Request, value string) bool
+	// ContentTypes lists the media types whose bodies are logged, with "*" wildcards.
+	// Other bodies are logged by size only. Defaults to DefaultBodyLogContentTypes. Bodies
+	// other than JSON and urlencoded forms, such as text/plain or XML, are logged as captured
+	// with only the redactor's value patterns applied, so list them only when they carry no
+	// secrets.
+	ContentTypes []string
+}
+
+// BodyLogger returns a middleware that adds request and response bodies to the request log
+// line as request_body and response_body. Bodies are copied as they stream through, up to
+// MaxBytes each, so handlers and streaming responses behave as without it; only the part of
+// the request body the handler reads is captured. JSON and form bodies are redacted with
+// GetRedactor and JSON bodies are logged as structured fields; those that cannot be parsed,
+// such as truncated ones, are logged by size and content type only. Bodies are logged for
+// requests matching Routes and the status rules, sampled at SampleRate, and for requests
+// carrying a debug header that Authorize accepts.
+func BodyLogger(opts BodyLogOptions) func(http.Handler) http.Handler {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 4 << 10
+	}
+	if opts.DebugHeader == "" {
+		opts.DebugHeader = DefaultBodyLogHeader
+	}
+	if opts.ContentTypes == nil {
+		opts.ContentTypes = DefaultBodyLogContentTypes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forced := false
+			if value := r.Header.Get(opts.DebugHeader); value != "" && opts.Authorize != nil {
+				forced = opts.Authorize(r, value)
+				if !forced {
+					SetLogField(r.Context(), "body_log_denied", true)
+				}
+			}
+			if !forced && opts.SampleRate > 0 && rand.Float64() >= opts.SampleRate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var reqBody *bodyCapture
+			if r.Body != nil && r.Body != http.NoBody {
+				reqBody = &bodyCapture{limit: opts.MaxBytes}
+				r.Body = &teeBody{ReadCloser: r.Body, capture: reqBody}
+			}
+			bw := &bodyLogWriter{ResponseWriter: w, capture: bodyCapture{limit: opts.MaxBytes}, status: http.StatusOK}
+
+			next.ServeHTTP(bw, r)
+
+			if !forced && !opts.matches(r, bw.status) {
+				return
+			}
+			if reqBody != nil {
+				opts.record(r, "request_body", r.Header.Get("Content-Type"), reqBody)
+			}
+			opts.record(r, "response_body", bw.Header().Get("Content-Type"), &bw.capture)
+		})
+	}
+}
+
+func (opts BodyLogOptions) matches(r *http.Request, status int) bool {
+	if len(opts.Statuses) > 0 || opts.MinStatus > 0 {
+		if !slices.Contains(opts.Statuses, status) && (opts.MinStatus <= 0 || status < opts.MinStatus) {
+			return false
+		}
+	}
+	if len(opts.Routes) == 0 {
+		return true
+	}
+
+	target := r.URL.Path
+	if route, ok := GetRoute(r.Context()); ok {
+		target = route.Pattern
+	}
+	for _, pattern := range opts.Routes {
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds a captured body to the request log. Bodies are redacted according to their
+// content type. JSON and form bodies that cannot be parsed, such as truncated ones, could
+// leak the fields redaction would mask, so only their size and content type are logged.
+// Other types are logged only when explicitly listed in ContentTypes.
+func (opts BodyLogOptions) record(r *http.Request, field, contentType string, c *bodyCapture) {
+	if c.total == 0 {
+		return
+	}
+	ctx := r.Context()
+	SetLogField(ctx, field+"_bytes", c.total)
+	if c.truncated() {
+		SetLogField(ctx, field+"_truncated", true)
+	}
+
+	body := c.buf.Bytes()
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !matchesMediaType(opts.ContentTypes, mediaType) {
+		SetLogField(ctx, field+"_content_type", mediaType)
+		return
+	}
+
+	redactor := GetRedactor()
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if redacted, err := RedactJSON(redactor, body); err == nil {
+			SetLogField(ctx, field, json.RawMessage(redacted))
+		} else {
+			SetLogField(ctx, field+"_content_type", mediaType)
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if c.truncated() {
+			SetLogField(ctx, field+"_content_type", mediaType)
+		} else {
+			SetLogField(ctx, field, RedactQuery(redactor, string(body)))
+		}
+	default:
+		value, _ := redactor.Field([]string{field}, string(body))
+		SetLogField(ctx, field, value)
+	}
+}
+
+func matchesMediaType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyCapture keeps the first limit bytes written to it and counts the rest
+type bodyCapture struct {
+	buf   bytes.Buffer
+	limit int
+	total int64
+}
+
+func (c *bodyCapture) write(b []byte) {
+	c.total += int64(len(b))
+	if room := c.limit - c.buf.Len(); room > 0 {
+		c.buf.Write(b[:min(room, len(b))])
+	}
+}
+
+func (c *bodyCapture) truncated() bool {
+	return c.total > int64(c.buf.Len())
+}
+
+// teeBody copies what the handler reads from the request body
+type teeBody struct {
+	io.ReadCloser
+	capture *bodyCapture
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.capture.write(p[:n])
+	return n, err
+}
+
+// bodyLogWriter copies the response body while passing every write and flush straight
+// through to the client
+type bodyLogWriter struct {
+	http.ResponseWriter
+	capture     bodyCapture
+	status      int
+	wroteHeader bool
+}
+
+func (bw *bodyLogWriter) WriteHeader(statusCode int) {
+	if !bw.wroteHeader {
+		bw.status = statusCode
+		bw.wroteHeader = true
+	}
+	bw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (bw *bodyLogWriter) Write(b []byte) (int, error) {
+	bw.wroteHeader = true
+	n, err := bw.ResponseWriter.Write(b)
+	bw.capture.write(b[:n])
+	return n, err
+}
+
+func (bw *bodyLogWriter) Flush() {
+	bw.wroteHeader = true
+	http.NewResponseController(bw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (bw *bodyLogWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLogger(t *testing.T) {
+	echo := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+			w.WriteHeader(status)
+			w.Write(body)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		opts          BodyLogOptions
+		status        int
+		contentType   string
+		body          string
+		debugHeader   string
+		expectedLogs  []string
+		unwantedLogs  []string
+		expectedField map[string]any
+	}{
+		{
+			name:        "json bodies are structured and redacted",
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"user":"alice","password":"hunter2"}`,
+			expectedLogs: []string{
+				`"request_body":{"password":"[REDACTED]","user":"alice"}`,
+				`"response_body":{"password":"[REDACTED]","user":"alice"}`,
+				`"request_body_bytes":37`,
+			},
+			unwantedLogs: []string{"hunter2"},
+		},
+		{
+			name:         "form bodies are redacted",
+			status:       http.StatusOK,
+			contentType:  "application/x-www-form-urlencoded",
+			body:         "user=alice&password=hunter2",
+			expectedLogs: []string{`"request_body":"password=%5BREDACTED%5D&user=alice"`},
+			unwantedLogs: []string{"hunter2"},
+		},
+		{
+			name:        "xml bodies are logged by size by default",
+			status:      http.StatusOK,
+			contentType: "application/xml",
+			body:        "<password>hunter2</password>",
+			expectedLogs: []string{
+				`"request_body_bytes":28`,
+				`"request_body_content_type":"application/xml"`,
+			},
+			unwantedLogs: []string{"hunter2", `"request_body":`},
+		},
+		{
+			name:        "bodies are truncated",
+			opts:        BodyLogOptions{MaxBytes: 8, ContentTypes: []string{"text/plain"}},
+			status:      http.StatusOK,
+			contentType: "text/plain",
+			body:        "0123456789abcdef",
+			expectedLogs: []string{
+				`"request_body":"01234567"`,
+				`"request_body_bytes":16`,
+				`"request_body_truncated":true`,
+			},
+		},
+		{
+			name:        "truncated json bodies are logged by size",
+			opts:        BodyLogOptions{MaxBytes: 24},
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        `{"user":"alice","password":"hunter2"}`,
+			expectedLogs: []string{
+				`"request_body_bytes":37`,
+				`"request_body_content_type":"application/json"`,
+			},
+			unwantedLogs: []string{"hunter2", `"request_body":`},
+		},
+		{
+			name:        "truncated form bodies are logged by size",
+			opts:        BodyLogOptions{MaxBytes: 24},
+			status:      http.StatusOK,
+			contentType: "application/x-www-form-urlencoded",
+			body:        "user=alice&password=hunter2",
+			expectedLogs: []string{
+				`"request_body_bytes":27`,
+				`"request_body_content_type":"application/x-www-form-urlencoded"`,
+			},
+			unwantedLogs: []string{"hunt", `"request_body":`},
+		},
+		{
+			name:        "binary bodies are logged by size",
+			status:      http.StatusOK,
+			contentType: "application/octet-stream",
+			body:        "\x00\x01\x02",
+			expectedLogs: []string{
+				`"request_body_bytes":3`,
+				`"request_body_content_type":"application/octet-stream"`,
+			},
+			unwantedLogs: []string{`"request_body":`},
+		},
+		{
+			name:         "status filter skips successes",
+			opts:         BodyLogOptions{MinStatus: 400},
+			status:       http.StatusOK,
+			contentType:  "application/json",
+			body:         `"fine"`,
+			unwantedLogs: []string{"request_body"},
+		},
+		{
+			name:         "status filter logs failures",
+			opts:         BodyLogOptions{MinStatus: 400},
+			status:       http.StatusUnprocessableEntity,
+			contentType:  "application/json",
+			body:         `"bad"`,
+			expectedLogs: []string{`"response_body":"bad"`},
+		},
+		{
+			name:         "route filter",
+			opts:         BodyLogOptions{Routes: []string{"/other/*"}},
+			status:       http.StatusOK,
+			contentType:  "application/json",
+			body:         `"hidden"`,
+			unwantedLogs: []string{"request_body"},
+		},
+		{
+			name:         "route filter uses the chi pattern",
+			opts:         BodyLogOptions{Routes: []string{"/items/{id}"}},
+			status:       http.StatusOK,
+			contentType:  "application/json",
+			body:         `"shown"`,
+			expectedLogs: []string{`"request_body":"shown"`},
+		},
+		{
+			name: "authorized debug header overrides filters",
+			opts: BodyLogOptions{
+				Statuses:   []int{http.StatusTeapot},
+				SampleRate: 0.0000001,
+				Authorize:  func(_ *http.Request, value string) bool { return value == "let-me-in" },
+			},
+			status:       http.StatusOK,
+			contentType:  "application/json",
+			body:         `"forced"`,
+			debugHeader:  "let-me-in",
+			expectedLogs: []string{`"request_body":"forced"`},
+		},
+		{
+			name: "unauthorized debug header is ignored",
+			opts: BodyLogOptions{
+				Statuses:  []int{http.StatusTeapot},
+				Authorize: func(_ *http.Request, value string) bool { return value == "let-me-in" },
+			},
+			status:       http.StatusOK,
+			contentType:  "application/json",
+			body:         `"guess"`,
+			debugHeader:  "guess",
+			expectedLogs: []string{`"body_log_denied":true`},
+			unwantedLogs: []string{"request_body"},
+		},
+		{
+			name:         "debug header is ignored without Authorize",
+			opts:         BodyLogOptions{Statuses: []int{http.StatusTeapot}},
+			status:       http.StatusOK,
+			contentType:  "application/json",
+			body:         `"anyone"`,
+			debugHeader:  "1",
+			unwantedLogs: []string{"request_body"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.Logger = zerolog.New(&buf)
+
+			r := chi.NewRouter()
+			r.Use(RequestLogger, BodyLogger(tt.opts))
+			r.Post("/items/{id}", echo(tt.status))
+
+			req := httptest.NewRequest(http.MethodPost, "/items/1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.debugHeader != "" {
+				req.Header.Set(DefaultBodyLogHeader, tt.debugHeader)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Body.String() != tt.body {
+				t.Errorf("response body = %q, want %q", rr.Body.String(), tt.body)
+			}
+			logStr := buf.String()
+			if !json.Valid(bytes.TrimSpace(buf.Bytes())) {
+				t.Errorf("log line is not valid JSON: %s", logStr)
+			}
+			for _, expected := range tt.expectedLogs {
+				if !strings.Contains(logStr, expected) {
+					t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+				}
+			}
+			for _, unwanted := range tt.unwantedLogs {
+				if strings.Contains(logStr, unwanted) {
+					t.Errorf("log contains %q\nLog: %s", unwanted, logStr)
+				}
+			}
+		})
+	}
+}
+
+func TestBodyLoggerStreaming(t *testing.T) {
+	log.Logger = zerolog.New(io.Discard)
+
+	flushed := make(chan struct{})
+	proceed := make(chan struct{})
+	handler := RequestLogger(BodyLogger(BodyLogOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush() error = %v", err)
+		}
+		close(flushed)
+		<-proceed
+		w.Write([]byte("data: 2\n\n"))
+	})))
+
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/events", nil))
+		close(done)
+	}()
+
+	<-flushed
+	if !rr.Flushed {
+		t.Error("expected the first event to be flushed to the client")
+	}
+	close(proceed)
+	<-done
+}
@@ -0,0 +1,413 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = logx.Named("cache")
+
+// StatusHeader reports how a response was served: HIT, STALE, MISS or BYPASS
+const StatusHeader = "X-Cache"
+
+// ErrNotCached is reported for only-if-cached requests that miss the cache
+var ErrNotCached = errors.New("response is not cached")
+
+// Options configures the caching middleware
+type Options struct {
+	// Store holds cached responses. Defaults to a 64 MiB LRU.
+	Store Store
+	// DefaultTTL is how long responses without max-age or s-maxage stay fresh. Such
+	// responses are not cached when it is zero.
+	DefaultTTL time.Duration
+	// StaleWhileRevalidate is used for responses without a stale-while-revalidate directive
+	StaleWhileRevalidate time.Duration
+	// VaryHeaders lists the request headers that are part of the cache key, such as
+	// Accept-Language. Responses that Vary on any other header are not cached.
+	VaryHeaders []string
+	// MaxBodySize is the largest response body cached. Defaults to 1 MiB.
+	MaxBodySize int
+	// AllowAuthorized caches requests carrying an Authorization header. Only enable it when
+	// VaryHeaders includes Authorization or responses do not depend on the caller.
+	AllowAuthorized bool
+}
+
+// cacheableStatus lists the statuses cached by default, following RFC 9110
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+type cache struct {
+	opts Options
+	vary []string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a request for a key that other requests for the same key wait on
+type flight struct {
+	done  chan struct{}
+	entry *Entry
+}
+
+// New returns a middleware that caches GET responses. Freshness comes from the handler's
+// Cache-Control max-age or s-maxage, falling back to DefaultTTL; no-store and private
+// responses, and responses setting cookies, are never cached. Clients can bypass the cache
+// with Cache-Control: no-store, force revalidation with no-cache, and ask for cached
+// responses only with only-if-cached. Concurrent misses for the same key are coalesced into
+// one handler call. Stale entries within their stale-while-revalidate window are served
+// while a single background request refreshes them. The outcome is reported in the
+// X-Cache header and as cache=hit|stale|miss|bypass in the request log.
+func New(opts Options) func(http.Handler) http.Handler {
+	return newCache(opts).wrap
+}
+
+func newCache(opts Options) *cache {
+	if opts.Store == nil {
+		opts.Store = NewLRU(64 << 20)
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	c := &cache{opts: opts, now: time.Now, flights: make(map[string]*flight)}
+	for _, h := range opts.VaryHeaders {
+		c.vary = append(c.vary, http.CanonicalHeaderKey(h))
+	}
+	slices.Sort(c.vary)
+	return c
+}
+
+func (c *cache) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serveHTTP(w, r, next)
+	})
+}
+
+func (c *cache) serveHTTP(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	directives := parseCacheControl(r.Header.Values("Cache-Control"))
+	if _, ok := directives["no-store"]; ok || (r.Header.Get("Authorization") != "" && !c.opts.AllowAuthorized) {
+		setStatus(w, r, "bypass")
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	key := c.key(r)
+	_, revalidate := directives["no-cache"]
+	revalidate = revalidate || directives["max-age"] == "0" || r.Header.Get("Pragma") == "no-cache"
+
+	if !revalidate {
+		entry, err := c.opts.Store.Get(r.Context(), key)
+		if err != nil {
+			middleware.SetLogField(r.Context(), "cache_error", err.Error())
+		}
+		if entry != nil {
+			age := c.now().Sub(entry.StoredAt)
+			if age < entry.FreshFor {
+				c.serveEntry(w, r, entry, "hit")
+				return
+			}
+			if age < entry.FreshFor+entry.StaleFor {
+				c.serveEntry(w, r, entry, "stale")
+				c.revalidate(key, r, next)
+				return
+			}
+		}
+		if _, ok := directives["only-if-cached"]; ok {
+			setStatus(w, r, "miss")
+			errorx.HandleError(w, r, errorx.NewApiError(ErrNotCached, http.StatusGatewayTimeout))
+			return
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		setStatus(w, r, "miss")
+		next.ServeHTTP(w, r)
+		return
+	}
+	c.fetch(w, r, next, key)
+}
+
+// fetch handles a miss, coalescing concurrent misses for the same key into one handler call
+func (c *cache) fetch(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	c.mu.Lock()
+	if f, ok := c.flights[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+		case <-r.Context().Done():
+			return
+		}
+		if f.entry != nil {
+			c.serveEntry(w, r, f.entry, "hit")
+			return
+		}
+		// The response could not be shared, so this request needs its own
+		setStatus(w, r, "miss")
+		next.ServeHTTP(w, r)
+		return
+	}
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.mu.Unlock()
+	defer c.land(key, f)
+
+	setStatus(w, r, "miss")
+	before := w.Header().Clone()
+	rec := &recorder{ResponseWriter: w, status: http.StatusOK, maxBody: c.opts.MaxBodySize}
+	next.ServeHTTP(rec, r)
+	f.entry = c.store(r.Context(), key, rec, before)
+}
+
+// revalidate refreshes a stale entry in the background unless a refresh is already running
+func (c *cache) revalidate(key string, r *http.Request, next http.Handler) {
+	c.mu.Lock()
+	if _, ok := c.flights[key]; ok {
+		c.mu.Unlock()
+		return
+	}
+	f := &flight{done: make(chan struct{})}
+	c.flights[key] = f
+	c.mu.Unlock()
+
+	ctx := middleware.CopyRouteContext(context.WithoutCancel(r.Context()))
+	req := r.Clone(ctx)
+	req.Header.Del("Cache-Control")
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+
+	go func() {
+		defer c.land(key, f)
+		defer func() {
+			if p := recover(); p != nil {
+				logger.Error(ctx, "Cache revalidation panicked", slog.Any("panic", p), slog.String("key", key))
+			}
+		}()
+
+		rec := &recorder{ResponseWriter: &discardWriter{header: http.Header{}}, status: http.StatusOK, maxBody: c.opts.MaxBodySize}
+		next.ServeHTTP(rec, req)
+		f.entry = c.store(ctx, key, rec, nil)
+	}()
+}
+
+func (c *cache) land(key string, f *flight) {
+	c.mu.Lock()
+	delete(c.flights, key)
+	c.mu.Unlock()
+	close(f.done)
+}
+
+// store saves a recorded response if it is cacheable, returning the entry or nil. Headers
+// that were already set before the handler ran belong to outer middleware and are dropped.
+func (c *cache) store(ctx context.Context, key string, rec *recorder, before http.Header) *Entry {
+	if !cacheableStatus[rec.status] || rec.overflow {
+		return nil
+	}
+	header := rec.header
+	if header == nil {
+		header = rec.ResponseWriter.Header().Clone()
+	}
+	if header.Get("Set-Cookie") != "" {
+		return nil
+	}
+
+	directives := parseCacheControl(header.Values("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return nil
+		}
+	}
+	for _, v := range parseList(header.Values("Vary")) {
+		if v == "*" {
+			return nil
+		}
+		if _, ok := slices.BinarySearch(c.vary, http.CanonicalHeaderKey(v)); !ok {
+			return nil
+		}
+	}
+
+	freshFor := c.opts.DefaultTTL
+	if v, ok := directives["s-maxage"]; ok {
+		freshFor = parseSeconds(v)
+	} else if v, ok := directives["max-age"]; ok {
+		freshFor = parseSeconds(v)
+	}
+	if freshFor <= 0 {
+		return nil
+	}
+	staleFor := c.opts.StaleWhileRevalidate
+	if v, ok := directives["stale-while-revalidate"]; ok {
+		staleFor = parseSeconds(v)
+	}
+
+	for k, v := range before {
+		if slices.Equal(header[k], v) {
+			delete(header, k)
+		}
+	}
+	header.Del(StatusHeader)
+	header.Del("Age")
+	header.Del("Content-Length")
+
+	entry := &Entry{
+		Status:   rec.status,
+		Header:   header,
+		Body:     bytes.Clone(rec.body.Bytes()),
+		StoredAt: c.now(),
+		FreshFor: freshFor,
+		StaleFor: staleFor,
+	}
+	if err := c.opts.Store.Set(ctx, key, entry); err != nil {
+		middleware.SetLogField(ctx, "cache_error", err.Error())
+		return nil
+	}
+	return entry
+}
+
+func (c *cache) serveEntry(w http.ResponseWriter, r *http.Request, entry *Entry, status string) {
+	setStatus(w, r, status)
+	dst := w.Header()
+	for k, v := range entry.Header {
+		dst[k] = slices.Clone(v)
+	}
+	dst.Set("Age", strconv.Itoa(int(c.now().Sub(entry.StoredAt).Seconds())))
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+// key identifies a response by host, path, sorted query and the configured request headers
+func (c *cache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(r.Host)
+	b.WriteString(r.URL.EscapedPath())
+	if query := r.URL.Query(); len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	for _, h := range c.vary {
+		b.WriteByte(0)
+		b.WriteString(h)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+func setStatus(w http.ResponseWriter, r *http.Request, status string) {
+	w.Header().Set(StatusHeader, strings.ToUpper(status))
+	middleware.SetLogField(r.Context(), "cache", status)
+}
+
+// parseCacheControl returns the directives of Cache-Control header values, keyed by
+// lower-cased name with unquoted values
+func parseCacheControl(values []string) map[string]string {
+	directives := make(map[string]string)
+	for _, d := range parseList(values) {
+		name, value, _ := strings.Cut(d, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return directives
+}
+
+func parseList(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func parseSeconds(v string) time.Duration {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// recorder captures the response while passing it through to the client
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	maxBody     int
+	overflow    bool
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(statusCode int) {
+	if !rec.wroteHeader {
+		rec.status = statusCode
+		rec.header = rec.ResponseWriter.Header().Clone()
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.overflow {
+		if rec.body.Len()+len(b) > rec.maxBody {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Flush() {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// discardWriter is the response writer for background revalidation, whose response only
+// goes to the cache
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
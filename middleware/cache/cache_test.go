@@ -0,0 +1,330 @@
+package cache
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingHandler responds with the number of times it has been called
+func countingHandler(calls *atomic.Int32, cacheControl string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
+		}
+		w.Write([]byte(strconv.Itoa(int(n))))
+	})
+}
+
+func TestCache(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           Options
+		cacheControl   string
+		requestHeaders map[string]string
+		secondHeaders  map[string]string
+		expectedStatus string
+		expectedBody   string
+	}{
+		{
+			name:           "max-age is cached",
+			cacheControl:   "max-age=60",
+			expectedStatus: "HIT",
+			expectedBody:   "1",
+		},
+		{
+			name:           "s-maxage is cached",
+			cacheControl:   "public, s-maxage=60",
+			expectedStatus: "HIT",
+			expectedBody:   "1",
+		},
+		{
+			name:           "default ttl",
+			opts:           Options{DefaultTTL: time.Minute},
+			expectedStatus: "HIT",
+			expectedBody:   "1",
+		},
+		{
+			name:           "no freshness is not cached",
+			expectedStatus: "MISS",
+			expectedBody:   "2",
+		},
+		{
+			name:           "no-store response",
+			cacheControl:   "no-store",
+			expectedStatus: "MISS",
+			expectedBody:   "2",
+		},
+		{
+			name:           "private response",
+			cacheControl:   "private, max-age=60",
+			expectedStatus: "MISS",
+			expectedBody:   "2",
+		},
+		{
+			name:           "request no-cache revalidates",
+			cacheControl:   "max-age=60",
+			secondHeaders:  map[string]string{"Cache-Control": "no-cache"},
+			expectedStatus: "MISS",
+			expectedBody:   "2",
+		},
+		{
+			name:           "request no-store bypasses",
+			cacheControl:   "max-age=60",
+			secondHeaders:  map[string]string{"Cache-Control": "no-store"},
+			expectedStatus: "BYPASS",
+			expectedBody:   "2",
+		},
+		{
+			name:           "authorized requests bypass",
+			cacheControl:   "max-age=60",
+			requestHeaders: map[string]string{"Authorization": "Bearer x"},
+			expectedStatus: "BYPASS",
+			expectedBody:   "2",
+		},
+		{
+			name:           "vary headers are part of the key",
+			opts:           Options{VaryHeaders: []string{"accept-language"}},
+			cacheControl:   "max-age=60",
+			requestHeaders: map[string]string{"Accept-Language": "en"},
+			secondHeaders:  map[string]string{"Accept-Language": "de"},
+			expectedStatus: "MISS",
+			expectedBody:   "2",
+		},
+		{
+			name:           "same vary header values hit",
+			opts:           Options{VaryHeaders: []string{"Accept-Language"}},
+			cacheControl:   "max-age=60",
+			requestHeaders: map[string]string{"Accept-Language": "en"},
+			expectedStatus: "HIT",
+			expectedBody:   "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			handler := New(tt.opts)(countingHandler(&calls, tt.cacheControl))
+
+			newRequest := func(headers map[string]string) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/items?b=2&a=1", nil)
+				for k, v := range tt.requestHeaders {
+					req.Header.Set(k, v)
+				}
+				for k, v := range headers {
+					req.Header.Set(k, v)
+				}
+				return req
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), newRequest(nil))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newRequest(tt.secondHeaders))
+
+			if got := rr.Header().Get(StatusHeader); got != tt.expectedStatus {
+				t.Errorf("%s = %q, want %q", StatusHeader, got, tt.expectedStatus)
+			}
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int32
+	revalidated := make(chan struct{}, 1)
+	c := newCache(Options{})
+	handler := c.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		w.Write([]byte(strconv.Itoa(int(n))))
+		if n > 1 {
+			revalidated <- struct{}{}
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	now := time.Now().Add(2 * time.Second)
+	c.now = func() time.Time { return now }
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Header().Get(StatusHeader) != "STALE" || rr.Body.String() != "1" {
+		t.Fatalf("got %s %q, want the stale response", rr.Header().Get(StatusHeader), rr.Body.String())
+	}
+	if rr.Header().Get("Age") != "2" {
+		t.Errorf("Age = %q, want 2", rr.Header().Get("Age"))
+	}
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not revalidated")
+	}
+	// Wait for the refreshed entry to be stored
+	for {
+		c.mu.Lock()
+		pending := len(c.flights)
+		c.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Header().Get(StatusHeader) != "HIT" || rr.Body.String() != "2" {
+		t.Errorf("got %s %q, want the revalidated response", rr.Header().Get(StatusHeader), rr.Body.String())
+	}
+}
+
+func TestCacheStaleWhileRevalidateBehindChi(t *testing.T) {
+	var calls atomic.Int32
+	revalidated := make(chan string, 1)
+	c := newCache(Options{})
+
+	r := chi.NewRouter()
+	r.Use(c.wrap)
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=1, stale-while-revalidate=60")
+		w.Write([]byte(chi.URLParam(r, "id")))
+		if n > 1 {
+			revalidated <- chi.URLParam(r, "id")
+		}
+	})
+	r.Get("/other", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items/7", nil))
+	now := time.Now().Add(2 * time.Second)
+	c.now = func() time.Time { return now }
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/items/7", nil))
+	if rr.Header().Get(StatusHeader) != "STALE" {
+		t.Fatalf("got %s, want the stale response", rr.Header().Get(StatusHeader))
+	}
+	// Reuse the pooled route context while the revalidation routes the request
+	for i := 0; i < 10; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+	}
+
+	select {
+	case id := <-revalidated:
+		if id != "7" {
+			t.Errorf("revalidation saw id %q, want 7", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not revalidated")
+	}
+}
+
+func TestCacheCoalescesMisses(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := newCache(Options{})
+	handler := c.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("shared"))
+	}))
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+			bodies[i] = rr.Body.String()
+		}()
+	}
+
+	// Wait until one request is in the handler before letting it finish
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("handler called %d times, want 1", got)
+	}
+	for i, body := range bodies {
+		if body != "shared" {
+			t.Errorf("request %d body = %q, want shared", i, body)
+		}
+	}
+	if len(c.flights) != 0 {
+		t.Errorf("%d flights left behind", len(c.flights))
+	}
+}
+
+func TestCacheOnlyIfCached(t *testing.T) {
+	var calls atomic.Int32
+	handler := New(Options{})(countingHandler(&calls, "max-age=60"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cache-Control", "only-if-cached")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusGatewayTimeout || calls.Load() != 0 {
+		t.Errorf("got status %d after %d calls, want 504 without calling the handler", rr.Code, calls.Load())
+	}
+}
+
+func TestCacheKeepsOuterHeaders(t *testing.T) {
+	var calls atomic.Int32
+	handler := New(Options{})(countingHandler(&calls, "max-age=60"))
+
+	for _, id := range []string{"first", "second"} {
+		rr := httptest.NewRecorder()
+		rr.Header().Set("X-Request-ID", id)
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := rr.Header().Get("X-Request-ID"); got != id {
+			t.Errorf("X-Request-ID = %q, want %q", got, id)
+		}
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRU(30)
+	entry := func() *Entry {
+		return &Entry{Status: http.StatusOK, Body: []byte("0123456789"), StoredAt: time.Now(), FreshFor: time.Minute}
+	}
+
+	store.Set(ctx, "a", entry())
+	store.Set(ctx, "b", entry())
+	store.Get(ctx, "a")
+	store.Set(ctx, "c", entry())
+
+	if e, _ := store.Get(ctx, "b"); e != nil {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if e, _ := store.Get(ctx, "a"); e == nil {
+		t.Error("expected recently used entry to be kept")
+	}
+	if store.Size() > 30 {
+		t.Errorf("size = %d, want at most 30", store.Size())
+	}
+
+	store.Set(ctx, "huge", &Entry{Body: make([]byte, 100), StoredAt: time.Now(), FreshFor: time.Minute})
+	if e, _ := store.Get(ctx, "huge"); e != nil {
+		t.Error("expected entry larger than the cache not to be stored")
+	}
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// StoredAt is when the response was generated
+	StoredAt time.Time
+	// FreshFor is how long the entry may be served without revalidation
+	FreshFor time.Duration
+	// StaleFor is how long past FreshFor the entry may be served while it is revalidated
+	StaleFor time.Duration
+}
+
+// Expires returns the time after which the entry can no longer be served
+func (e *Entry) Expires() time.Time {
+	return e.StoredAt.Add(e.FreshFor + e.StaleFor)
+}
+
+func (e *Entry) size(key string) int64 {
+	n := len(key) + len(e.Body)
+	for k, values := range e.Header {
+		n += len(k)
+		for _, v := range values {
+			n += len(v)
+		}
+	}
+	return int64(n)
+}
+
+// Store holds cached responses. Get returns nil without an error on a miss.
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Set stores e under key until e.Expires
+	Set(ctx context.Context, key string, e *Entry) error
+	Delete(ctx context.Context, key string) error
+}
+
+var _ Store = (*LRU)(nil)
+
+// LRU is an in-memory Store bounded by the total size of its entries, evicting the least
+// recently used entries first
+type LRU struct {
+	maxBytes int64
+	now      func() time.Time
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *Entry
+	size  int64
+}
+
+// NewLRU creates an empty LRU holding at most maxBytes of keys, headers and bodies
+func NewLRU(maxBytes int64) *LRU {
+	return &LRU{
+		maxBytes: maxBytes,
+		now:      time.Now,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the entry for key if it has not expired
+func (s *LRU) Get(_ context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	item := el.Value.(*lruItem)
+	if s.now().After(item.entry.Expires()) {
+		s.remove(el)
+		return nil, nil
+	}
+	s.order.MoveToFront(el)
+	return item.entry, nil
+}
+
+// Set stores e, evicting older entries as needed. Entries larger than the whole cache are
+// not stored.
+func (s *LRU) Set(_ context.Context, key string, e *Entry) error {
+	size := e.size(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	if size > s.maxBytes {
+		return nil
+	}
+
+	s.items[key] = s.order.PushFront(&lruItem{key: key, entry: e, size: size})
+	s.size += size
+	for s.size > s.maxBytes {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+// Delete removes the entry for key
+func (s *LRU) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+// Len returns the number of cached entries
+func (s *LRU) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// Size returns the total size of cached entries in bytes
+func (s *LRU) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func (s *LRU) remove(el *list.Element) {
+	item := s.order.Remove(el).(*lruItem)
+	delete(s.items, item.key)
+	s.size -= item.size
+}
@@ -0,0 +1,347 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Content codings supported by Compress
+const (
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+)
+
+// DefaultCompressMinSize is the response size below which Compress leaves bodies uncompressed
+const DefaultCompressMinSize = 1024
+
+var defaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/javascript",
+	"application/xml",
+	"application/*+xml",
+	"image/svg+xml",
+}
+
+// CompressOptions configures the Compress middleware
+type CompressOptions struct {
+	// Encodings lists the content codings to offer, in order of server preference.
+	// Defaults to zstd, br and gzip.
+	Encodings []string
+	// MinSize is the number of bytes a response must reach before it is compressed.
+	// Defaults to DefaultCompressMinSize; a negative value compresses every eligible response.
+	MinSize int
+	// ContentTypes lists the media types eligible for compression. Entries may use a
+	// wildcard subtype such as "text/*" or a structured suffix such as "application/*+json".
+	ContentTypes []string
+}
+
+// encoder is implemented by the pooled writers of every supported coding
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	EncodingGzip: {New: func() any {
+		return gzip.NewWriter(io.Discard)
+	}},
+	EncodingZstd: {New: func() any {
+		enc, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+	EncodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression)
+	}},
+}
+
+// Compress returns a middleware that compresses response bodies using the best content
+// coding the client accepts, as negotiated from Accept-Encoding q-values. Only responses of
+// an eligible content type that reach the minimum size are compressed. When used beneath
+// RequestLogger, the uncompressed size and chosen coding are added to the log line.
+func Compress(opts CompressOptions) func(http.Handler) http.Handler {
+	if len(opts.Encodings) == 0 {
+		opts.Encodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = DefaultCompressMinSize
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = defaultCompressibleTypes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), opts.Encodings)
+
+			cw := &compressWriter{
+				w:        w,
+				r:        r,
+				opts:     &opts,
+				encoding: encoding,
+				status:   http.StatusOK,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the supported coding with the highest q-value, breaking ties
+// by server preference. It returns an empty string when identity should be used.
+func negotiateEncoding(header string, supported []string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, entry := range strings.Split(header, ",") {
+		name, q := parseQValue(entry)
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supported {
+		q, ok := qualities[enc]
+		if !ok {
+			if wildcard < 0 {
+				continue
+			}
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+func parseQValue(entry string) (string, float64) {
+	parts := strings.Split(entry, ";")
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	q := 1.0
+	for _, param := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", 0
+		}
+		q = parsed
+	}
+	return name, q
+}
+
+// compressWriter buffers the start of a response until it can decide whether to compress it
+type compressWriter struct {
+	w        http.ResponseWriter
+	r        *http.Request
+	opts     *CompressOptions
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	enc         encoder
+	written     int64
+}
+
+func (cw *compressWriter) Header() http.Header {
+	return cw.w.Header()
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.wroteHeader {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 {
+		cw.w.WriteHeader(statusCode)
+		return
+	}
+	cw.status = statusCode
+	cw.wroteHeader = true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	cw.written += int64(len(b))
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.opts.MinSize {
+			return len(b), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.w.Write(b)
+}
+
+// Flush forces a decision so that streamed responses are not held back by the size threshold
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.w).Flush()
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := cw.w.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("underlying ResponseWriter does not implement http.Hijacker")
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.w
+}
+
+// decide writes the buffered header and body, starting an encoder if the response qualifies.
+// sizeReached reports whether the response is large enough, or streamed, to be worth compressing.
+func (cw *compressWriter) decide(sizeReached bool) error {
+	cw.decided = true
+	h := cw.w.Header()
+
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if cw.compressibleType(h.Get("Content-Type")) && h.Get("Content-Encoding") == "" {
+		addVary(h, "Accept-Encoding")
+		if sizeReached && cw.shouldCompress() {
+			pool := encoderPools[cw.encoding]
+			cw.enc = pool.Get().(encoder)
+			cw.enc.Reset(cw.w)
+
+			h.Set("Content-Encoding", cw.encoding)
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+
+	cw.w.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.w.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) shouldCompress() bool {
+	if cw.encoding == "" || cw.r.Method == http.MethodHead {
+		return false
+	}
+	if _, ok := encoderPools[cw.encoding]; !ok {
+		return false
+	}
+	switch cw.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	return true
+}
+
+func (cw *compressWriter) compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaTypeMatches(mediaType, cw.opts.ContentTypes)
+}
+
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader && !cw.decided {
+		return
+	}
+	if !cw.decided {
+		cw.decide(len(cw.buf) > 0 && len(cw.buf) >= cw.opts.MinSize)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(io.Discard)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+
+		SetLogField(cw.r.Context(), "content_encoding", cw.encoding)
+		SetLogField(cw.r.Context(), "bytes_uncompressed", cw.written)
+	}
+}
+
+// mediaTypeMatches reports whether mediaType matches any pattern. Patterns may be exact,
+// use a wildcard subtype ("text/*") or a wildcard with structured suffix ("application/*+json").
+func mediaTypeMatches(mediaType string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == mediaType || pattern == "*/*" {
+			return true
+		}
+		prefix, suffix, ok := strings.Cut(pattern, "*")
+		if ok && strings.HasPrefix(mediaType, prefix) && strings.HasSuffix(mediaType, suffix) &&
+			len(mediaType) > len(prefix)+len(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary appends value to the Vary header unless it is already listed
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, existing := range strings.Split(v, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
@@ -0,0 +1,331 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "empty header", header: "", expected: ""},
+		{name: "single coding", header: "gzip", expected: EncodingGzip},
+		{name: "server preference breaks ties", header: "gzip, br, zstd", expected: EncodingZstd},
+		{name: "highest q wins", header: "gzip;q=1.0, zstd;q=0.5", expected: EncodingGzip},
+		{name: "q zero excludes", header: "zstd;q=0, br;q=0, gzip", expected: EncodingGzip},
+		{name: "wildcard", header: "*", expected: EncodingZstd},
+		{name: "wildcard with exclusion", header: "*;q=0.5, zstd;q=0", expected: EncodingBrotli},
+		{name: "unsupported only", header: "compress, identity", expected: ""},
+		{name: "malformed q ignored", header: "zstd;q=abc, gzip", expected: EncodingGzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header, supported); got != tt.expected {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.expected)
+			}
+		})
+	}
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case EncodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create gzip reader: %v", err)
+		}
+		r = gr
+	case EncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create zstd reader: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	case EncodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decompress %s body: %v", encoding, err)
+	}
+	return string(out)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"message":"hello world"}`, 100)
+
+	tests := []struct {
+		name             string
+		method           string
+		acceptEncoding   string
+		contentType      string
+		body             string
+		status           int
+		opts             CompressOptions
+		expectedEncoding string
+		expectVary       bool
+	}{
+		{
+			name:             "gzip",
+			acceptEncoding:   "gzip",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: EncodingGzip,
+			expectVary:       true,
+		},
+		{
+			name:             "zstd",
+			acceptEncoding:   "gzip, zstd",
+			contentType:      "application/json",
+			body:             large,
+			expectedEncoding: EncodingZstd,
+			expectVary:       true,
+		},
+		{
+			name:             "brotli",
+			acceptEncoding:   "br",
+			contentType:      "text/html; charset=utf-8",
+			body:             large,
+			expectedEncoding: EncodingBrotli,
+			expectVary:       true,
+		},
+		{
+			name:           "below minimum size",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           `{"small":true}`,
+			expectVary:     true,
+		},
+		{
+			name:           "ineligible content type",
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           large,
+		},
+		{
+			name:        "client does not accept",
+			contentType: "application/json",
+			body:        large,
+			expectVary:  true,
+		},
+		{
+			name:             "custom content types",
+			acceptEncoding:   "gzip",
+			contentType:      "application/vnd.custom",
+			body:             large,
+			opts:             CompressOptions{ContentTypes: []string{"application/vnd.custom"}},
+			expectedEncoding: EncodingGzip,
+			expectVary:       true,
+		},
+		{
+			name:             "restricted encodings",
+			acceptEncoding:   "zstd, gzip",
+			contentType:      "application/json",
+			body:             large,
+			opts:             CompressOptions{Encodings: []string{EncodingGzip}},
+			expectedEncoding: EncodingGzip,
+			expectVary:       true,
+		},
+		{
+			name:           "no content",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			status:         http.StatusNoContent,
+			expectVary:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Compress(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				if tt.body != "" {
+					// Write in chunks to exercise buffering across calls
+					for i := 0; i < len(tt.body); i += 100 {
+						end := min(i+100, len(tt.body))
+						w.Write([]byte(tt.body[i:end]))
+					}
+				}
+			}))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.expectedEncoding)
+			}
+			if got := rr.Header().Get("Vary") == "Accept-Encoding"; got != tt.expectVary {
+				t.Errorf("Vary = %q, expected Accept-Encoding: %v", rr.Header().Get("Vary"), tt.expectVary)
+			}
+			if got := decompress(t, tt.expectedEncoding, rr.Body.Bytes()); got != tt.body {
+				t.Errorf("decoded body does not match, got %d bytes want %d", len(got), len(tt.body))
+			}
+			if tt.expectedEncoding != "" && rr.Body.Len() >= len(tt.body) {
+				t.Errorf("compressed body (%d bytes) is not smaller than original (%d bytes)", rr.Body.Len(), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestCompressPreservesExistingEncoding(t *testing.T) {
+	handler := Compress(CompressOptions{MinSize: -1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte("already compressed"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+	if rr.Body.String() != "already compressed" {
+		t.Errorf("body was modified: %q", rr.Body.String())
+	}
+}
+
+func TestCompressWeakensETag(t *testing.T) {
+	handler := Compress(CompressOptions{MinSize: -1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("ETag = %q, want W/\"abc\"", got)
+	}
+}
+
+func TestCompressFlushStreams(t *testing.T) {
+	flushed := make(chan struct{})
+	proceed := make(chan struct{})
+
+	handler := Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		close(flushed)
+		<-proceed
+		w.Write([]byte("data: second\n\n"))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rr, req)
+		close(done)
+	}()
+
+	<-flushed
+	if !rr.Flushed {
+		t.Error("underlying writer was not flushed")
+	}
+	if rr.Header().Get("Content-Encoding") != EncodingGzip {
+		t.Error("streamed response below the minimum size should still be compressed once flushed")
+	}
+	close(proceed)
+	<-done
+
+	if got := decompress(t, EncodingGzip, rr.Body.Bytes()); got != "data: first\n\ndata: second\n\n" {
+		t.Errorf("unexpected streamed body %q", got)
+	}
+}
+
+func TestCompressReportsByteCounts(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+
+	body := strings.Repeat("a", 4096)
+	handler := RequestLogger(Compress(CompressOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(body))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var entry struct {
+		Bytes             int64  `json:"bytes"`
+		BytesUncompressed int64  `json:"bytes_uncompressed"`
+		ContentEncoding   string `json:"content_encoding"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to parse log line: %v\nLog: %s", err, buf.String())
+	}
+
+	if entry.BytesUncompressed != int64(len(body)) {
+		t.Errorf("bytes_uncompressed = %d, want %d", entry.BytesUncompressed, len(body))
+	}
+	if entry.Bytes != int64(rr.Body.Len()) {
+		t.Errorf("bytes = %d, want %d", entry.Bytes, rr.Body.Len())
+	}
+	if entry.ContentEncoding != EncodingGzip {
+		t.Errorf("content_encoding = %q, want gzip", entry.ContentEncoding)
+	}
+}
+
+func TestMediaTypeMatches(t *testing.T) {
+	patterns := []string{"text/*", "application/json", "application/*+json"}
+
+	tests := map[string]bool{
+		"text/html":                true,
+		"application/json":         true,
+		"application/problem+json": true,
+		"application/xml":          false,
+		"image/png":                false,
+	}
+
+	for mediaType, expected := range tests {
+		if got := mediaTypeMatches(mediaType, patterns); got != expected {
+			t.Errorf("mediaTypeMatches(%q) = %v, want %v", mediaType, got, expected)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package concurrency
+
+import (
+	"math"
+	"time"
+)
+
+// Sample describes a completed request
+type Sample struct {
+	// RTT is how long the request took to handle
+	RTT time.Duration
+	// InFlight is the number of requests in flight when it completed, including itself
+	InFlight int
+	// Dropped reports that the request timed out or the handler reported overload
+	Dropped bool
+}
+
+// Algorithm adapts the concurrency limit to observed behaviour. Update is called with the
+// limiter's lock held, so implementations need no locking of their own but must be cheap.
+type Algorithm interface {
+	// Update returns the new limit after a request completes
+	Update(limit int, sample Sample) int
+}
+
+// AIMD grows the limit by one after each successful request made while the limit was
+// nearly reached, and cuts it multiplicatively when a request is dropped or too slow
+type AIMD struct {
+	MinLimit int
+	MaxLimit int
+	// Backoff is the factor applied to the limit on a drop. Defaults to 0.9.
+	Backoff float64
+	// SlowThreshold treats requests slower than it as drops. Zero disables it.
+	SlowThreshold time.Duration
+}
+
+func (a *AIMD) Update(limit int, sample Sample) int {
+	backoff := a.Backoff
+	if backoff <= 0 || backoff >= 1 {
+		backoff = 0.9
+	}
+
+	if sample.Dropped || (a.SlowThreshold > 0 && sample.RTT > a.SlowThreshold) {
+		limit = int(float64(limit) * backoff)
+	} else if sample.InFlight*2 >= limit {
+		// Only grow when the limit is actually being used, so that an idle service does
+		// not accumulate a limit it has never proven it can handle
+		limit++
+	}
+	return clamp(limit, a.MinLimit, a.MaxLimit)
+}
+
+// Gradient compares each request's latency to a long-term baseline. While latency stays
+// near the baseline the limit grows by roughly its square root; as latency rises above it
+// the limit shrinks in proportion, shedding load before queues build up. A Gradient keeps
+// state between updates and must not be shared by several limiters.
+type Gradient struct {
+	MinLimit int
+	MaxLimit int
+	// Tolerance is how far latency may rise above the baseline before the limit shrinks.
+	// Defaults to 1.5.
+	Tolerance float64
+	// Smoothing weights each update. Defaults to 0.2.
+	Smoothing float64
+	// Window is the number of samples the baseline averages over. Defaults to 600.
+	Window int
+
+	baseline float64
+	limit    float64
+}
+
+func (g *Gradient) Update(limit int, sample Sample) int {
+	tolerance := g.Tolerance
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+	smoothing := g.Smoothing
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	window := g.Window
+	if window <= 0 {
+		window = 600
+	}
+
+	if g.limit == 0 || int(g.limit) != limit {
+		g.limit = float64(limit)
+	}
+
+	rtt := float64(sample.RTT)
+	if rtt <= 0 {
+		return limit
+	}
+	if g.baseline == 0 {
+		g.baseline = rtt
+	} else {
+		g.baseline += (rtt - g.baseline) / float64(window)
+	}
+
+	if sample.Dropped {
+		g.limit = float64(clamp(int(g.limit*0.5), g.MinLimit, g.MaxLimit))
+		return int(g.limit)
+	}
+
+	gradient := math.Max(0.5, math.Min(1, tolerance*g.baseline/rtt))
+	target := g.limit*gradient + math.Sqrt(g.limit)
+	g.limit = g.limit*(1-smoothing) + target*smoothing
+	g.limit = float64(clamp(int(math.Round(g.limit)), g.MinLimit, g.MaxLimit))
+	return int(g.limit)
+}
+
+func clamp(limit, minLimit, maxLimit int) int {
+	if minLimit <= 0 {
+		minLimit = 1
+	}
+	if maxLimit > 0 && limit > maxLimit {
+		limit = maxLimit
+	}
+	return max(limit, minLimit)
+}
@@ -0,0 +1,249 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Reasons a request is shed, reported to Options.OnShed and in the request log
+const (
+	ReasonQueueFull = "queue_full"
+	ReasonQueueWait = "queue_timeout"
+)
+
+// DefaultRetryAfter is the Retry-After hint sent with shed requests when none is configured
+const DefaultRetryAfter = time.Second
+
+// StatusClientClosedRequest is recorded for requests whose client gave up while queued,
+// following nginx's convention
+const StatusClientClosedRequest = 499
+
+// ErrOverloaded is the error reported for shed requests
+var ErrOverloaded = errors.New("server is overloaded, try again later")
+
+// Options configures a Limiter
+type Options struct {
+	// Limit is the maximum number of requests handled at once, and the starting limit when
+	// an adaptive Algorithm is set
+	Limit int
+	// Algorithm adjusts the limit from observed latency. The limit is fixed when nil.
+	Algorithm Algorithm
+	// MaxQueue is the number of requests that may wait for a slot. Requests beyond it are
+	// shed immediately; zero disables queueing.
+	MaxQueue int
+	// MaxWait bounds how long a queued request waits for a slot. Defaults to one second.
+	MaxWait time.Duration
+	// RetryAfter is sent to shed clients. Defaults to DefaultRetryAfter.
+	RetryAfter time.Duration
+	// OnShed is called for every shed request, for example to increment a metric
+	OnShed func(r *http.Request, reason string)
+}
+
+// Stats is a snapshot of a Limiter's state and counters
+type Stats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+	// Accepted counts requests that were handled
+	Accepted uint64
+	// ShedQueueFull counts requests shed because the queue was full
+	ShedQueueFull uint64
+	// ShedQueueWait counts requests shed after waiting MaxWait in the queue
+	ShedQueueWait uint64
+	// Abandoned counts requests whose client gave up while queued
+	Abandoned uint64
+}
+
+// Limiter caps the number of requests in flight. Create one per router or route group
+// whose capacity should be managed together.
+type Limiter struct {
+	opts Options
+	now  func() time.Time
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	queue    []*waiter
+	stats    Stats
+}
+
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewLimiter returns a Limiter. It panics if Limit is not positive.
+func NewLimiter(opts Options) *Limiter {
+	if opts.Limit <= 0 {
+		panic("concurrency: Limit must be positive")
+	}
+	if opts.MaxWait <= 0 {
+		opts.MaxWait = time.Second
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = DefaultRetryAfter
+	}
+	return &Limiter{opts: opts, now: time.Now, limit: opts.Limit}
+}
+
+// New returns a middleware backed by a new Limiter
+func New(opts Options) func(http.Handler) http.Handler {
+	return NewLimiter(opts).Handler
+}
+
+// Handler is the middleware enforcing the limit. Requests beyond it wait in the queue if
+// there is room, and are otherwise rejected with 503 and Retry-After.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	retryAfter := strconv.Itoa(int(math.Ceil(l.opts.RetryAfter.Seconds())))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason, ok := l.acquire(r.Context()); !ok {
+			if reason == "" {
+				// The client gave up while queued. Nobody reads the response, but the status
+				// keeps the request log and access logs from reporting it as served.
+				middleware.SetLogField(r.Context(), "queue_abandoned", true)
+				w.WriteHeader(StatusClientClosedRequest)
+				return
+			}
+			middleware.SetLogField(r.Context(), "shed", reason)
+			if l.opts.OnShed != nil {
+				l.opts.OnShed(r, reason)
+			}
+			w.Header().Set("Retry-After", retryAfter)
+			// Shedding is expected under load, so it is left to the request log and OnShed
+			// rather than logged as an internal error
+			errorx.RespondError(w, errorx.NewApiError(ErrOverloaded, http.StatusServiceUnavailable))
+			return
+		}
+
+		start := l.now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			dropped := sw.status == http.StatusServiceUnavailable ||
+				sw.status == http.StatusGatewayTimeout ||
+				errors.Is(r.Context().Err(), context.DeadlineExceeded)
+			l.release(Sample{RTT: l.now().Sub(start), Dropped: dropped})
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// Stats returns a snapshot of the limiter's state and counters
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.Limit = l.limit
+	stats.InFlight = l.inFlight
+	stats.Queued = len(l.queue)
+	return stats
+}
+
+// acquire takes a slot, waiting in the queue if necessary. It returns the shed reason when
+// no slot could be taken, or an empty reason if ctx ended while waiting.
+func (l *Limiter) acquire(ctx context.Context) (string, bool) {
+	l.mu.Lock()
+	if l.inFlight < l.limit {
+		l.inFlight++
+		l.stats.Accepted++
+		l.mu.Unlock()
+		return "", true
+	}
+	if len(l.queue) >= l.opts.MaxQueue {
+		l.stats.ShedQueueFull++
+		l.mu.Unlock()
+		return ReasonQueueFull, false
+	}
+	w := &waiter{ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.opts.MaxWait)
+	defer timer.Stop()
+
+	var reason string
+	select {
+	case <-w.ready:
+		return "", true
+	case <-timer.C:
+		reason = ReasonQueueWait
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		// A slot was handed over just as the wait ended
+		return "", true
+	}
+	for i, queued := range l.queue {
+		if queued == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			break
+		}
+	}
+	if reason == ReasonQueueWait {
+		l.stats.ShedQueueWait++
+	} else {
+		l.stats.Abandoned++
+	}
+	return reason, false
+}
+
+func (l *Limiter) release(sample Sample) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sample.InFlight = l.inFlight
+	l.inFlight--
+	if l.opts.Algorithm != nil {
+		l.limit = max(1, l.opts.Algorithm.Update(l.limit, sample))
+	}
+
+	for len(l.queue) > 0 && l.inFlight < l.limit {
+		w := l.queue[0]
+		l.queue = l.queue[1:]
+		w.granted = true
+		l.inFlight++
+		l.stats.Accepted++
+		close(w.ready)
+	}
+}
+
+// statusWriter records the response status so overloaded responses can be fed back to
+// the limit algorithm
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(statusCode int) {
+	if !sw.wroteHeader {
+		sw.status = statusCode
+		sw.wroteHeader = true
+	}
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wroteHeader = true
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *statusWriter) Flush() {
+	sw.wroteHeader = true
+	http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
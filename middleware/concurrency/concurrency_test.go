@@ -0,0 +1,266 @@
+package concurrency
+
+import (
+	"bytes"
+	"context"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingHandler holds requests until release is closed, signalling entered for each one
+func blockingHandler(entered chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func serve(handler http.Handler) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	return rr
+}
+
+func TestLimiterShedsWhenFull(t *testing.T) {
+	entered := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	var shedReasons []string
+	limiter := NewLimiter(Options{
+		Limit:      2,
+		RetryAfter: 1500 * time.Millisecond,
+		OnShed: func(r *http.Request, reason string) {
+			shedReasons = append(shedReasons, reason)
+		},
+	})
+	handler := limiter.Handler(blockingHandler(entered, release))
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rr := serve(handler); rr.Code != http.StatusNoContent {
+				t.Errorf("admitted request status = %d, want 204", rr.Code)
+			}
+		}()
+	}
+	<-entered
+	<-entered
+
+	rr := serve(handler)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	if expected := `{"error":"server is overloaded, try again later","code":503}`; strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("body = %s, want %s", rr.Body.String(), expected)
+	}
+	if len(shedReasons) != 1 || shedReasons[0] != ReasonQueueFull {
+		t.Errorf("OnShed reasons = %v, want [%s]", shedReasons, ReasonQueueFull)
+	}
+
+	close(release)
+	wg.Wait()
+
+	stats := limiter.Stats()
+	if stats.Accepted != 2 || stats.ShedQueueFull != 1 || stats.InFlight != 0 {
+		t.Errorf("stats = %+v, want 2 accepted, 1 shed, none in flight", stats)
+	}
+}
+
+func TestLimiterQueue(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxWait      time.Duration
+		releaseAfter time.Duration
+		expectedCode int
+	}{
+		{
+			name:         "slot frees within the wait",
+			maxWait:      time.Second,
+			releaseAfter: 10 * time.Millisecond,
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:         "wait runs out",
+			maxWait:      20 * time.Millisecond,
+			releaseAfter: 100 * time.Millisecond,
+			expectedCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entered := make(chan struct{}, 2)
+			release := make(chan struct{})
+			limiter := NewLimiter(Options{Limit: 1, MaxQueue: 1, MaxWait: tt.maxWait})
+			handler := limiter.Handler(blockingHandler(entered, release))
+
+			done := make(chan struct{})
+			go func() {
+				serve(handler)
+				close(done)
+			}()
+			<-entered
+
+			time.AfterFunc(tt.releaseAfter, func() { close(release) })
+			rr := serve(handler)
+			<-done
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if stats := limiter.Stats(); stats.Queued != 0 || stats.InFlight != 0 {
+				t.Errorf("stats = %+v, want empty queue and nothing in flight", stats)
+			}
+		})
+	}
+}
+
+func TestLimiterQueueFull(t *testing.T) {
+	entered := make(chan struct{}, 3)
+	release := make(chan struct{})
+	limiter := NewLimiter(Options{Limit: 1, MaxQueue: 1, MaxWait: time.Second})
+	handler := limiter.Handler(blockingHandler(entered, release))
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(handler)
+		}()
+	}
+	<-entered
+	for limiter.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if rr := serve(handler); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 with a full queue, got %d", rr.Code)
+	}
+	close(release)
+	wg.Wait()
+
+	if stats := limiter.Stats(); stats.Accepted != 2 || stats.ShedQueueFull != 1 {
+		t.Errorf("stats = %+v, want 2 accepted and 1 shed", stats)
+	}
+}
+
+func TestLimiterQueueAbandoned(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	limiter := NewLimiter(Options{Limit: 1, MaxQueue: 1, MaxWait: time.Minute})
+	handler := limiter.Handler(blockingHandler(entered, release))
+
+	done := make(chan struct{})
+	go func() {
+		serve(handler)
+		close(done)
+	}()
+	<-entered
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	rr := httptest.NewRecorder()
+	middleware.RequestLogger(handler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	close(release)
+	<-done
+
+	if rr.Code != StatusClientClosedRequest {
+		t.Errorf("status = %d, want %d", rr.Code, StatusClientClosedRequest)
+	}
+	for _, expected := range []string{`"status":499`, `"queue_abandoned":true`} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("log doesn't contain %q\nLog: %s", expected, buf.String())
+		}
+	}
+	if stats := limiter.Stats(); stats.Abandoned != 1 || stats.ShedQueueWait != 0 || stats.Queued != 0 {
+		t.Errorf("stats = %+v, want 1 abandoned and an empty queue", stats)
+	}
+}
+
+func TestAIMD(t *testing.T) {
+	a := &AIMD{MinLimit: 5, MaxLimit: 12, SlowThreshold: time.Second}
+
+	tests := []struct {
+		name     string
+		limit    int
+		sample   Sample
+		expected int
+	}{
+		{name: "grows when busy", limit: 10, sample: Sample{RTT: time.Millisecond, InFlight: 10}, expected: 11},
+		{name: "holds when idle", limit: 10, sample: Sample{RTT: time.Millisecond, InFlight: 1}, expected: 10},
+		{name: "capped at max", limit: 12, sample: Sample{RTT: time.Millisecond, InFlight: 12}, expected: 12},
+		{name: "backs off on drop", limit: 10, sample: Sample{RTT: time.Millisecond, Dropped: true}, expected: 9},
+		{name: "backs off when slow", limit: 10, sample: Sample{RTT: 2 * time.Second, InFlight: 10}, expected: 9},
+		{name: "floored at min", limit: 5, sample: Sample{Dropped: true}, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Update(tt.limit, tt.sample); got != tt.expected {
+				t.Errorf("Update(%d) = %d, want %d", tt.limit, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGradient(t *testing.T) {
+	g := &Gradient{MinLimit: 1, MaxLimit: 100}
+
+	limit := 20
+	for range 50 {
+		limit = g.Update(limit, Sample{RTT: 10 * time.Millisecond, InFlight: limit})
+	}
+	if limit <= 20 {
+		t.Errorf("limit = %d after steady latency, want growth above 20", limit)
+	}
+
+	grown := limit
+	for range 20 {
+		limit = g.Update(limit, Sample{RTT: 100 * time.Millisecond, InFlight: limit})
+	}
+	if limit >= grown {
+		t.Errorf("limit = %d after latency rose tenfold, want below %d", limit, grown)
+	}
+
+	if got := g.Update(limit, Sample{RTT: 10 * time.Millisecond, Dropped: true}); got != max(1, limit/2) {
+		t.Errorf("limit after drop = %d, want %d", got, max(1, limit/2))
+	}
+}
+
+func TestLimiterAppliesAlgorithm(t *testing.T) {
+	limiter := NewLimiter(Options{Limit: 10, Algorithm: &AIMD{MinLimit: 1}})
+	handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	serve(handler)
+	if got := limiter.Stats().Limit; got != 9 {
+		t.Errorf("limit after an overloaded response = %d, want 9", got)
+	}
+}
+
+func TestNewLimiterRejectsNonPositiveLimit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for zero limit")
+		}
+	}()
+	NewLimiter(Options{})
+}
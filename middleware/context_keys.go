@@ -5,4 +5,8 @@ type ctxKey int
 const (
 	errorCtxKey ctxKey = iota
 	requestIDKey
+	logFieldsKey
+	cspNonceKey
+	clientInfoKey
+	traceContextKey
 )
@@ -0,0 +1,239 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+	}
+	defaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"}
+)
+
+// CORSOptions configures the CORS middleware
+type CORSOptions struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests. Entries are
+	// exact origins such as "https://app.example.com", wildcard subdomains such as
+	// "https://*.example.com", or "*" for any origin.
+	AllowedOrigins []string
+	// AllowedOriginPatterns lists regular expressions matched against the full origin. They
+	// are anchored at both ends, so `https://example\.com` does not allow
+	// https://example.com.evil.net.
+	AllowedOriginPatterns []*regexp.Regexp
+	// AllowOriginFunc is consulted for origins not matched by the lists above
+	AllowOriginFunc func(r *http.Request, origin string) bool
+	// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowedMethods []string
+	// AllowedHeaders lists the request headers clients may send. Defaults to Accept,
+	// Authorization, Content-Type and X-Request-ID; "*" allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers readable by clients in addition to X-Request-ID
+	ExposedHeaders []string
+	// AllowCredentials permits cookies and HTTP authentication. It cannot be combined with
+	// the "*" origin.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight results. Zero omits the header.
+	MaxAge time.Duration
+	// OptionsPassthrough passes preflight requests on to the next handler instead of
+	// answering them directly
+	OptionsPassthrough bool
+}
+
+type cors struct {
+	opts          CORSOptions
+	allowAll      bool
+	exact         map[string]bool
+	wildcards     [][2]string
+	patterns      []*regexp.Regexp
+	methods       string
+	allowedHeader map[string]bool
+	anyHeader     bool
+	exposed       string
+}
+
+// CORS returns a middleware implementing cross-origin resource sharing. Preflight requests
+// are answered directly with 204, so they never reach route handlers, and every response
+// to a cross-origin request carries `Vary: Origin` so caches keep per-origin copies apart.
+// Requests from disallowed origins are served without CORS headers, leaving the browser
+// to block them. CORS panics if AllowCredentials is combined with the "*" origin.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = defaultCORSMethods
+	}
+	if len(opts.AllowedHeaders) == 0 {
+		opts.AllowedHeaders = defaultCORSHeaders
+	}
+
+	c := &cors{
+		opts:          opts,
+		exact:         map[string]bool{},
+		methods:       strings.Join(opts.AllowedMethods, ", "),
+		allowedHeader: map[string]bool{},
+	}
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			c.allowAll = true
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+		default:
+			c.exact[origin] = true
+		}
+	}
+	for _, pattern := range opts.AllowedOriginPatterns {
+		c.patterns = append(c.patterns, regexp.MustCompile(`^(?:`+pattern.String()+`)$`))
+	}
+	if c.allowAll && opts.AllowCredentials {
+		panic("middleware: CORS cannot allow credentials for the \"*\" origin")
+	}
+	for _, header := range opts.AllowedHeaders {
+		if header == "*" {
+			c.anyHeader = true
+		}
+		c.allowedHeader[http.CanonicalHeaderKey(header)] = true
+	}
+	c.exposed = strings.Join(append([]string{"X-Request-ID"}, opts.ExposedHeaders...), ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				c.handlePreflight(w, r, origin)
+				if opts.OptionsPassthrough {
+					next.ServeHTTP(w, r)
+				} else {
+					w.WriteHeader(http.StatusNoContent)
+				}
+				return
+			}
+
+			c.handleActual(w, r, origin)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (c *cors) handlePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	addVary(h, "Origin")
+	addVary(h, "Access-Control-Request-Method")
+	addVary(h, "Access-Control-Request-Headers")
+
+	if !c.originAllowed(r, origin) {
+		SetLogField(r.Context(), "cors_denied", origin)
+		return
+	}
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !c.methodAllowed(method) {
+		SetLogField(r.Context(), "cors_denied", "method "+method)
+		return
+	}
+
+	requested := parseHeaderList(r.Header.Values("Access-Control-Request-Headers"))
+	for _, header := range requested {
+		if !c.anyHeader && !c.allowedHeader[http.CanonicalHeaderKey(header)] {
+			SetLogField(r.Context(), "cors_denied", "header "+header)
+			return
+		}
+	}
+
+	c.setAllowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", c.methods)
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.opts.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge/time.Second)))
+	}
+}
+
+func (c *cors) handleActual(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	addVary(h, "Origin")
+
+	if !c.originAllowed(r, origin) {
+		return
+	}
+
+	c.setAllowOrigin(h, origin)
+	h.Set("Access-Control-Expose-Headers", c.exposed)
+}
+
+func (c *cors) setAllowOrigin(h http.Header, origin string) {
+	if c.allowAll {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) originAllowed(r *http.Request, origin string) bool {
+	if c.allowAll {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	if c.exact[lower] {
+		return true
+	}
+	for _, w := range c.wildcards {
+		prefix, suffix := w[0], w[1]
+		if len(lower) > len(prefix)+len(suffix) && strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return c.opts.AllowOriginFunc != nil && c.opts.AllowOriginFunc(r, origin)
+}
+
+func (c *cors) methodAllowed(method string) bool {
+	// Simple methods never trigger a preflight and so are always permitted
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodPost {
+		return true
+	}
+	for _, m := range c.opts.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHeaderList splits comma separated header values, dropping empty entries
+func parseHeaderList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	opts := CORSOptions{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []*regexp.Regexp{
+			regexp.MustCompile(`^https://pr-\d+\.preview\.dev$`),
+			regexp.MustCompile(`https://legacy\.example\.net`),
+		},
+		AllowOriginFunc: func(r *http.Request, origin string) bool {
+			return origin == "https://partner.test"
+		},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		headers         map[string]string
+		expectedCode    int
+		expectedOrigin  string
+		expectedHeaders map[string]string
+		expectNext      bool
+	}{
+		{
+			name:       "same origin request",
+			method:     http.MethodGet,
+			expectNext: true,
+		},
+		{
+			name:           "exact origin",
+			method:         http.MethodGet,
+			headers:        map[string]string{"Origin": "https://app.example.com"},
+			expectedOrigin: "https://app.example.com",
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Request-ID, ETag",
+			},
+			expectNext: true,
+		},
+		{
+			name:           "wildcard subdomain",
+			method:         http.MethodGet,
+			headers:        map[string]string{"Origin": "https://api.eu.example.org"},
+			expectedOrigin: "https://api.eu.example.org",
+			expectNext:     true,
+		},
+		{
+			name:       "wildcard requires a subdomain",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://.example.org"},
+			expectNext: true,
+		},
+		{
+			name:           "regex origin",
+			method:         http.MethodGet,
+			headers:        map[string]string{"Origin": "https://pr-42.preview.dev"},
+			expectedOrigin: "https://pr-42.preview.dev",
+			expectNext:     true,
+		},
+		{
+			name:           "unanchored regex origin",
+			method:         http.MethodGet,
+			headers:        map[string]string{"Origin": "https://legacy.example.net"},
+			expectedOrigin: "https://legacy.example.net",
+			expectNext:     true,
+		},
+		{
+			name:       "unanchored regex must match the whole origin",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://legacy.example.net.evil.test"},
+			expectNext: true,
+		},
+		{
+			name:           "callback origin",
+			method:         http.MethodGet,
+			headers:        map[string]string{"Origin": "https://partner.test"},
+			expectedOrigin: "https://partner.test",
+			expectNext:     true,
+		},
+		{
+			name:       "disallowed origin",
+			method:     http.MethodGet,
+			headers:    map[string]string{"Origin": "https://evil.test"},
+			expectNext: true,
+		},
+		{
+			name:   "preflight",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPut,
+				"Access-Control-Request-Headers": "content-type, authorization",
+			},
+			expectedCode:   http.StatusNoContent,
+			expectedOrigin: "https://app.example.com",
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "content-type, authorization",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:   "preflight with disallowed header",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  http.MethodPut,
+				"Access-Control-Request-Headers": "X-Secret",
+			},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:   "preflight with disallowed method",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PROPFIND",
+			},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:   "preflight from disallowed origin",
+			method: http.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://evil.test",
+				"Access-Control-Request-Method": http.MethodGet,
+			},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			name:           "plain options request",
+			method:         http.MethodOptions,
+			headers:        map[string]string{"Origin": "https://app.example.com"},
+			expectedCode:   http.StatusOK,
+			expectedOrigin: "https://app.example.com",
+			expectNext:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := CORS(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			expectedCode := tt.expectedCode
+			if expectedCode == 0 {
+				expectedCode = http.StatusOK
+			}
+			if rr.Code != expectedCode {
+				t.Errorf("expected status %d, got %d", expectedCode, rr.Code)
+			}
+			if called != tt.expectNext {
+				t.Errorf("next handler called = %v, want %v", called, tt.expectNext)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.expectedOrigin)
+			}
+			for k, v := range tt.expectedHeaders {
+				if got := rr.Header().Get(k); got != v {
+					t.Errorf("%s = %q, want %q", k, got, v)
+				}
+			}
+			if tt.headers["Origin"] != "" && !strings.Contains(strings.Join(rr.Header().Values("Vary"), ","), "Origin") {
+				t.Errorf("Vary = %q, want Origin", rr.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	handler := CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://anything.test")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "X-Custom" {
+		t.Errorf("Access-Control-Allow-Headers = %q, want X-Custom", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want empty", got)
+	}
+}
+
+func TestCORSOptionsPassthrough(t *testing.T) {
+	handler := CORS(CORSOptions{AllowedOrigins: []string{"https://app.test"}, OptionsPassthrough: true})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://app.test")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("expected preflight to reach next handler, got status %d", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://app.test" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+}
+
+func TestCORSRejectsCredentialsWithAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for credentials with \"*\" origin")
+		}
+	}()
+	CORS(CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
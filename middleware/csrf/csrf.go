@@ -0,0 +1,345 @@
+package csrf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Mode selects how the expected token is kept between requests
+type Mode int
+
+const (
+	// DoubleSubmit keeps a signed token in a cookie and requires it to be echoed back in a
+	// header or form field. No server-side state is needed.
+	DoubleSubmit Mode = iota
+	// Synchronizer keeps the token server-side in a TokenStore, keyed by the caller's session
+	Synchronizer
+)
+
+// Defaults applied to empty Options fields
+const (
+	DefaultCookieName = "csrf_token"
+	DefaultHeaderName = "X-CSRF-Token"
+	DefaultFieldName  = "csrf_token"
+	DefaultMaxAge     = 12 * time.Hour
+)
+
+// MaxFormPeek bounds how much of a form body is buffered while looking for the token field
+const MaxFormPeek = 10 << 20
+
+// maxTokenSize bounds the token field read from a multipart body
+const maxTokenSize = 1 << 10
+
+var (
+	ErrTokenMissing  = errors.New("CSRF token missing")
+	ErrTokenInvalid  = errors.New("CSRF token invalid")
+	ErrOriginInvalid = errors.New("cross-origin request rejected")
+)
+
+type ctxKey int
+
+const tokenKey ctxKey = iota
+
+// Options configures the CSRF middleware
+type Options struct {
+	Mode Mode
+	// Secret signs double-submit cookies so that only this server can issue them. Tokens are
+	// not bound to a session, so an attacker able to set cookies for the domain, such as
+	// from a sibling subdomain, can plant a cookie and token pair fetched for themselves;
+	// use Synchronizer mode where that matters. Defaults to a random per-process secret,
+	// which invalidates tokens on restart and cannot be shared between replicas.
+	Secret []byte
+	// Store holds synchronizer tokens. Required in Synchronizer mode.
+	Store TokenStore
+
+	CookieName   string
+	CookiePath   string
+	CookieDomain string
+	// InsecureCookie drops the Secure attribute, for local development over plain HTTP
+	InsecureCookie bool
+	// SameSite defaults to http.SameSiteLaxMode
+	SameSite http.SameSite
+	// MaxAge is the lifetime of double-submit cookies
+	MaxAge time.Duration
+
+	// HeaderName is the request header JSON clients send the token in
+	HeaderName string
+	// FieldName is the form field browsers send the token in, in a urlencoded or multipart
+	// body. Up to MaxFormPeek bytes of the body are buffered to find it and replayed to the
+	// handler, so put the field before any file inputs.
+	FieldName string
+
+	// TrustedOrigins lists origins besides the request's own host that may submit unsafe
+	// requests, such as "https://app.example.com"
+	TrustedOrigins []string
+	// ExemptPaths lists path.Match patterns, such as "/webhooks/*", that are not checked
+	ExemptPaths []string
+	// Exempt reports whether a request should skip checking
+	Exempt func(r *http.Request) bool
+}
+
+// New returns a middleware protecting unsafe requests against cross-site request forgery.
+// A token is issued to every caller and made available through Token and TemplateField.
+// POST, PUT, PATCH and DELETE requests must carry an acceptable Origin or Referer and echo
+// the token in the configured header or form field, otherwise they receive 403.
+func New(opts Options) func(http.Handler) http.Handler {
+	if opts.Mode == Synchronizer && opts.Store == nil {
+		panic("csrf: Synchronizer mode requires a Store")
+	}
+	if len(opts.Secret) == 0 {
+		opts.Secret = randomBytes(tokenLength)
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = DefaultCookieName
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.MaxAge == 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = DefaultHeaderName
+	}
+	if opts.FieldName == "" {
+		opts.FieldName = DefaultFieldName
+	}
+
+	p := &protector{opts: opts, trusted: map[string]bool{}}
+	for _, origin := range opts.TrustedOrigins {
+		p.trusted[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, err := p.token(w, r)
+			if err != nil {
+				errorx.HandleError(w, r, errorx.InternalServerErr(fmt.Errorf("failed to load CSRF token: %w", err)))
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), tokenKey, &tokenState{raw: token, fieldName: opts.FieldName}))
+			// Responses embedding a per-user token must not be shared between users
+			w.Header().Add("Vary", "Cookie")
+
+			if isSafeMethod(r.Method) || p.exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := p.checkOrigin(r); err != nil {
+				p.reject(w, r, err)
+				return
+			}
+
+			submitted := r.Header.Get(opts.HeaderName)
+			if submitted == "" {
+				submitted = formToken(r, opts.FieldName)
+			}
+			if submitted == "" {
+				p.reject(w, r, ErrTokenMissing)
+				return
+			}
+			if !tokensEqual(token, unmask(submitted)) {
+				p.reject(w, r, ErrTokenInvalid)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// formToken returns the named field of a urlencoded or multipart body, then restores r.Body
+// so that handlers decoding the form still read all of it
+func formToken(r *http.Request, field string) string {
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Body == nil || (mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data") {
+		return ""
+	}
+
+	var read bytes.Buffer
+	body := r.Body
+	peek := io.TeeReader(io.LimitReader(body, MaxFormPeek), &read)
+	defer func() {
+		r.Body = replayBody{Reader: io.MultiReader(&read, body), Closer: body}
+	}()
+
+	if mediaType == "application/x-www-form-urlencoded" {
+		raw, err := io.ReadAll(peek)
+		if err != nil || len(raw) >= MaxFormPeek {
+			return ""
+		}
+		values, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return ""
+		}
+		return values.Get(field)
+	}
+
+	mr := multipart.NewReader(peek, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == field && part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxTokenSize))
+			if err != nil {
+				return ""
+			}
+			return string(value)
+		}
+	}
+}
+
+// replayBody replays the bytes read by formToken before the rest of the original body
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+type tokenState struct {
+	raw       []byte
+	fieldName string
+}
+
+// Token returns a token for the request to embed in a form or hand to a JSON client. A
+// fresh mask is applied on every call so the value differs between responses, preventing
+// compression side channels from recovering it.
+func Token(r *http.Request) string {
+	state, ok := r.Context().Value(tokenKey).(*tokenState)
+	if !ok {
+		return ""
+	}
+	return mask(state.raw)
+}
+
+// TemplateField returns a hidden input carrying the request's token, for use in forms
+func TemplateField(r *http.Request) template.HTML {
+	state, ok := r.Context().Value(tokenKey).(*tokenState)
+	if !ok {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(state.fieldName), mask(state.raw)))
+}
+
+// TokenHandler responds with the request's token as JSON, for clients that cannot read it
+// from a rendered page
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	token := Token(r)
+	if token == "" {
+		errorx.HandleError(w, r, errorx.InternalServerErr(errors.New("csrf middleware is not installed")))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"token":%q}`+"\n", token)
+}
+
+type protector struct {
+	opts    Options
+	trusted map[string]bool
+}
+
+// token returns the caller's raw token, issuing a new one when none is held
+func (p *protector) token(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if p.opts.Mode == Synchronizer {
+		stored, err := p.opts.Store.Get(r)
+		if err != nil {
+			return nil, err
+		}
+		if raw, ok := decodeRaw(stored); ok {
+			return raw, nil
+		}
+		raw := randomBytes(tokenLength)
+		if err := p.opts.Store.Save(w, r, encodeRaw(raw)); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+
+	if cookie, err := r.Cookie(p.opts.CookieName); err == nil {
+		if raw, ok := verifySigned(p.opts.Secret, cookie.Value); ok {
+			return raw, nil
+		}
+	}
+	raw := randomBytes(tokenLength)
+	http.SetCookie(w, &http.Cookie{
+		Name:     p.opts.CookieName,
+		Value:    sign(p.opts.Secret, raw),
+		Path:     p.opts.CookiePath,
+		Domain:   p.opts.CookieDomain,
+		MaxAge:   int(p.opts.MaxAge / time.Second),
+		Secure:   !p.opts.InsecureCookie,
+		HttpOnly: true,
+		SameSite: p.opts.SameSite,
+	})
+	return raw, nil
+}
+
+func (p *protector) exempt(r *http.Request) bool {
+	for _, pattern := range p.opts.ExemptPaths {
+		if ok, _ := path.Match(pattern, r.URL.Path); ok {
+			return true
+		}
+	}
+	return p.opts.Exempt != nil && p.opts.Exempt(r)
+}
+
+// checkOrigin requires the Origin header, or the Referer when no Origin is sent, to match
+// the request's host or a trusted origin. Requests carrying neither are left to the token
+// check, as some clients legitimately strip both.
+func (p *protector) checkOrigin(r *http.Request) error {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return nil
+	}
+	if source == "null" {
+		return ErrOriginInvalid
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return ErrOriginInvalid
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	if p.trusted[strings.ToLower(u.Scheme+"://"+u.Host)] {
+		return nil
+	}
+	return ErrOriginInvalid
+}
+
+func (p *protector) reject(w http.ResponseWriter, r *http.Request, err error) {
+	middleware.SetLogField(r.Context(), "csrf_failure", err.Error())
+	errorx.HandleError(w, r, errorx.ForbiddenErr(err))
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package csrf
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/httpx"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// issue performs a GET through handler, returning the issued cookie and a masked token
+func issue(t *testing.T, handler http.Handler) (*http.Cookie, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/token", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode token response: %v", err)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one cookie, got %d", len(cookies))
+	}
+	return cookies[0], body.Token
+}
+
+func newTestHandler(opts Options) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", TokenHandler)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	return New(opts)(mux)
+}
+
+func TestDoubleSubmit(t *testing.T) {
+	handler := newTestHandler(Options{
+		Secret:         []byte("test-secret"),
+		TrustedOrigins: []string{"https://app.example.com"},
+		ExemptPaths:    []string{"/webhooks/*"},
+	})
+	cookie, token := issue(t, handler)
+
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie attributes = %+v", cookie)
+	}
+
+	otherCookie, otherToken := issue(t, newTestHandler(Options{Secret: []byte("other-secret")}))
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		cookie       *http.Cookie
+		header       string
+		form         url.Values
+		origin       string
+		referer      string
+		expectedCode int
+	}{
+		{name: "safe method without token", method: http.MethodGet, path: "/", expectedCode: http.StatusOK},
+		{name: "header token", method: http.MethodPost, path: "/", cookie: cookie, header: token, expectedCode: http.StatusOK},
+		{name: "form token", method: http.MethodPost, path: "/", cookie: cookie, form: url.Values{"csrf_token": {token}}, expectedCode: http.StatusOK},
+		{name: "missing token", method: http.MethodPost, path: "/", cookie: cookie, expectedCode: http.StatusForbidden},
+		{name: "missing cookie", method: http.MethodPost, path: "/", header: token, expectedCode: http.StatusForbidden},
+		{name: "mismatched token", method: http.MethodDelete, path: "/", cookie: cookie, header: otherToken, expectedCode: http.StatusForbidden},
+		{name: "cookie signed by another secret", method: http.MethodPost, path: "/", cookie: otherCookie, header: otherToken, expectedCode: http.StatusForbidden},
+		{name: "raw cookie value as token", method: http.MethodPost, path: "/", cookie: cookie, header: cookie.Value, expectedCode: http.StatusForbidden},
+		{name: "same origin", method: http.MethodPost, path: "/", cookie: cookie, header: token, origin: "https://example.com", expectedCode: http.StatusOK},
+		{name: "trusted origin", method: http.MethodPost, path: "/", cookie: cookie, header: token, origin: "https://app.example.com", expectedCode: http.StatusOK},
+		{name: "cross origin", method: http.MethodPost, path: "/", cookie: cookie, header: token, origin: "https://evil.test", expectedCode: http.StatusForbidden},
+		{name: "null origin", method: http.MethodPost, path: "/", cookie: cookie, header: token, origin: "null", expectedCode: http.StatusForbidden},
+		{name: "cross origin referer", method: http.MethodPost, path: "/", cookie: cookie, header: token, referer: "https://evil.test/form", expectedCode: http.StatusForbidden},
+		{name: "same origin referer", method: http.MethodPost, path: "/", cookie: cookie, header: token, referer: "https://example.com/form", expectedCode: http.StatusOK},
+		{name: "exempt path", method: http.MethodPost, path: "/webhooks/github", expectedCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			if tt.form != nil {
+				req = httptest.NewRequest(tt.method, "https://example.com"+tt.path, strings.NewReader(tt.form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(tt.method, "https://example.com"+tt.path, nil)
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			if tt.header != "" {
+				req.Header.Set(DefaultHeaderName, tt.header)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestFormBodyReachesHandler(t *testing.T) {
+	type signup struct {
+		Email string `form:"email"`
+	}
+
+	handler := New(Options{Secret: []byte("test-secret")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var dst signup
+		var apiErr *errorx.ApiError
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			var form *httpx.MultipartForm
+			if form, apiErr = httpx.ParseMultipart(r, httpx.MultipartOptions{Sink: httpx.MemorySink()}); apiErr == nil {
+				apiErr = form.Bind(&dst)
+			}
+		} else {
+			apiErr = httpx.DecodeForm(r, &dst)
+		}
+		if apiErr != nil {
+			errorx.HandleError(w, r, apiErr)
+			return
+		}
+		w.Write([]byte(dst.Email))
+	}))
+	cookie, token := issue(t, newTestHandler(Options{Secret: []byte("test-secret")}))
+
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField("csrf_token", token)
+	mw.WriteField("email", "ada@example.com")
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{
+			name:        "urlencoded",
+			contentType: "application/x-www-form-urlencoded",
+			body:        url.Values{"csrf_token": {token}, "email": {"ada@example.com"}}.Encode(),
+		},
+		{
+			name:        "multipart",
+			contentType: mw.FormDataContentType(),
+			body:        multipartBody.String(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "https://example.com/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.AddCookie(cookie)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK || rr.Body.String() != "ada@example.com" {
+				t.Errorf("status = %d, body = %q, want the decoded form", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokensAreMaskedPerCall(t *testing.T) {
+	handler := New(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, second := Token(r), Token(r)
+		if first == second {
+			t.Error("expected differently masked tokens")
+		}
+		if !tokensEqual(unmask(first), unmask(second)) {
+			t.Error("masked tokens do not unmask to the same value")
+		}
+
+		field := string(TemplateField(r))
+		if !strings.HasPrefix(field, `<input type="hidden" name="csrf_token" value="`) {
+			t.Errorf("TemplateField() = %q", field)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestSynchronizer(t *testing.T) {
+	store := NewMemoryStore(func(r *http.Request) string {
+		return r.Header.Get("X-Session")
+	}, 0)
+
+	var token string
+	handler := New(Options{Mode: Synchronizer, Store: store})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token = Token(r)
+		}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Session", "session-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("synchronizer mode should not set cookies")
+	}
+
+	tests := []struct {
+		name         string
+		session      string
+		expectedCode int
+	}{
+		{name: "same session", session: "session-1", expectedCode: http.StatusOK},
+		{name: "other session", session: "session-2", expectedCode: http.StatusForbidden},
+		{name: "no session", expectedCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("X-Session", tt.session)
+			req.Header.Set(DefaultHeaderName, token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestSynchronizerRequiresStore(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic without a store")
+		}
+	}()
+	New(Options{Mode: Synchronizer})
+}
@@ -0,0 +1,85 @@
+package csrf
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+var _ TokenStore = (*MemoryStore)(nil)
+
+// TokenStore keeps synchronizer tokens server-side, keyed by the caller's session
+type TokenStore interface {
+	// Get returns the token stored for the request's session, or an empty string
+	Get(r *http.Request) (string, error)
+	// Save stores token for the request's session
+	Save(w http.ResponseWriter, r *http.Request, token string) error
+}
+
+// MemoryStore is an in-process TokenStore. Tokens expire after the configured TTL and are
+// swept lazily.
+type MemoryStore struct {
+	session func(r *http.Request) string
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	tokens    map[string]storedToken
+	lastSweep time.Time
+}
+
+type storedToken struct {
+	token   string
+	expires time.Time
+}
+
+// NewMemoryStore returns a store keeping one token per session, as identified by session.
+// Requests for which session returns an empty string share no token and so always fail
+// the check; auth.PrincipalID or a session cookie lookup are typical choices.
+func NewMemoryStore(session func(r *http.Request) string, ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultMaxAge
+	}
+	return &MemoryStore{
+		session: session,
+		ttl:     ttl,
+		now:     time.Now,
+		tokens:  map[string]storedToken{},
+	}
+}
+
+func (s *MemoryStore) Get(r *http.Request) (string, error) {
+	id := s.session(r)
+	if id == "" {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.tokens[id]
+	if !ok || s.now().After(entry.expires) {
+		return "", nil
+	}
+	return entry.token, nil
+}
+
+func (s *MemoryStore) Save(_ http.ResponseWriter, r *http.Request, token string) error {
+	id := s.session(r)
+	if id == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.lastSweep) > s.ttl {
+		for k, entry := range s.tokens {
+			if now.After(entry.expires) {
+				delete(s.tokens, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.tokens[id] = storedToken{token: token, expires: now.Add(s.ttl)}
+	return nil
+}
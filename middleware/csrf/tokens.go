@@ -0,0 +1,88 @@
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+)
+
+const tokenLength = 32
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("csrf: failed to generate random bytes: " + err.Error())
+	}
+	return b
+}
+
+func encodeRaw(raw []byte) string {
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeRaw(s string) ([]byte, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(raw) != tokenLength {
+		return nil, false
+	}
+	return raw, true
+}
+
+// sign encodes raw with an HMAC so the cookie can only have been issued by this server
+func sign(secret, raw []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(raw)
+	return encodeRaw(raw) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifySigned(secret []byte, value string) ([]byte, bool) {
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, false
+	}
+	raw, ok := decodeRaw(encoded)
+	if !ok {
+		return nil, false
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(raw)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nil, false
+	}
+	return raw, true
+}
+
+// mask XORs raw with a random one-time pad, returning the pad followed by the result
+func mask(raw []byte) string {
+	pad := randomBytes(len(raw))
+	masked := make([]byte, 2*len(raw))
+	copy(masked, pad)
+	for i := range raw {
+		masked[len(raw)+i] = pad[i] ^ raw[i]
+	}
+	return encodeRaw(masked)
+}
+
+func unmask(token string) []byte {
+	masked, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(masked) != 2*tokenLength {
+		return nil
+	}
+	raw := make([]byte, tokenLength)
+	for i := range raw {
+		raw[i] = masked[i] ^ masked[tokenLength+i]
+	}
+	return raw
+}
+
+func tokensEqual(expected, submitted []byte) bool {
+	return len(submitted) == len(expected) && subtle.ConstantTimeCompare(expected, submitted) == 1
+}
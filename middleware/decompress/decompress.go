@@ -0,0 +1,169 @@
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxSize is the decompressed body limit applied when Options.MaxSize is zero
+const DefaultMaxSize int64 = 10 << 20
+
+// Content codings understood by the middleware
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingZstd    = "zstd"
+)
+
+var errTooLarge = errors.New("decompressed body exceeds the maximum allowed size")
+
+// Options configures the decompression middleware
+type Options struct {
+	// MaxSize limits the size of the decompressed body to protect against decompression
+	// bombs. Defaults to DefaultMaxSize.
+	MaxSize int64
+	// Encodings lists the accepted content codings. Defaults to gzip, deflate and zstd.
+	Encodings []string
+}
+
+// New returns a middleware that decodes request bodies sent with a Content-Encoding of
+// gzip, deflate or zstd. The body is fully decoded before the handler runs so that
+// oversized payloads are rejected with 413 and unsupported codings with 415. Handlers see
+// the decoded body with the Content-Encoding header removed.
+func New(opts Options) func(http.Handler) http.Handler {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if len(opts.Encodings) == 0 {
+		opts.Encodings = []string{EncodingGzip, EncodingDeflate, EncodingZstd}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			codings := parseCodings(r.Header.Values("Content-Encoding"))
+			if len(codings) == 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, coding := range codings {
+				if !supported(coding, opts.Encodings) {
+					w.Header().Set("Accept-Encoding", strings.Join(opts.Encodings, ", "))
+					errorx.HandleError(w, r, errorx.UnsupportedMediaTypeErr(
+						fmt.Errorf("Content-Encoding %s is not supported", coding)))
+					return
+				}
+			}
+
+			body, err := decode(r.Body, codings, opts.MaxSize)
+			r.Body.Close()
+			if err != nil {
+				if errors.Is(err, errTooLarge) {
+					errorx.HandleError(w, r, errorx.PayloadTooLargeErr(err))
+					return
+				}
+				errorx.HandleError(w, r, errorx.BadRequestErr(fmt.Errorf("failed to decompress request body: %w", err)))
+				return
+			}
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			r.ContentLength = int64(len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseCodings returns the content codings in the order they were applied, ignoring identity
+func parseCodings(values []string) []string {
+	var codings []string
+	for _, v := range values {
+		for _, coding := range strings.Split(v, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	return codings
+}
+
+func supported(coding string, encodings []string) bool {
+	for _, enc := range encodings {
+		if enc == coding {
+			return true
+		}
+	}
+	return false
+}
+
+// decode undoes each coding in reverse order of application, reading at most maxSize
+// decoded bytes
+func decode(body io.Reader, codings []string, maxSize int64) ([]byte, error) {
+	r := body
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoder, err := newDecoder(codings[i], r, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		r = decoder
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > maxSize {
+		return nil, errTooLarge
+	}
+	return decoded, nil
+}
+
+func newDecoder(coding string, r io.Reader, maxSize int64) (io.ReadCloser, error) {
+	switch coding {
+	case EncodingGzip:
+		return gzip.NewReader(r)
+	case EncodingDeflate:
+		return newDeflateReader(r)
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(uint64(max(min(maxSize, zstd.MaxWindowSize), zstd.MinWindowSize))),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("Content-Encoding %s is not supported", coding)
+}
+
+// newDeflateReader accepts both zlib-wrapped streams, as the HTTP deflate coding requires,
+// and raw deflate streams, which many clients send instead
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+
+	// A zlib header has compression method 8 and a checksum that is a multiple of 31
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
@@ -0,0 +1,198 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func compress(t *testing.T, coding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "flate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			t.Fatalf("failed to create flate writer: %v", err)
+		}
+		w = fw
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatalf("failed to create zstd writer: %v", err)
+		}
+		w = zw
+	default:
+		t.Fatalf("unknown coding %s", coding)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	payload := []byte(`{"name":"mjolnir","tags":["a","b","c"]}`)
+
+	tests := []struct {
+		name            string
+		contentEncoding string
+		body            func(t *testing.T) []byte
+		opts            Options
+		expectedCode    int
+		expectedBody    string
+	}{
+		{
+			name:            "gzip",
+			contentEncoding: "gzip",
+			body:            func(t *testing.T) []byte { return compress(t, "gzip", payload) },
+			expectedCode:    http.StatusOK,
+			expectedBody:    string(payload),
+		},
+		{
+			name:            "zlib deflate",
+			contentEncoding: "deflate",
+			body:            func(t *testing.T) []byte { return compress(t, "zlib", payload) },
+			expectedCode:    http.StatusOK,
+			expectedBody:    string(payload),
+		},
+		{
+			name:            "raw deflate",
+			contentEncoding: "deflate",
+			body:            func(t *testing.T) []byte { return compress(t, "flate", payload) },
+			expectedCode:    http.StatusOK,
+			expectedBody:    string(payload),
+		},
+		{
+			name:            "zstd",
+			contentEncoding: "zstd",
+			body:            func(t *testing.T) []byte { return compress(t, "zstd", payload) },
+			expectedCode:    http.StatusOK,
+			expectedBody:    string(payload),
+		},
+		{
+			name:            "stacked codings",
+			contentEncoding: "zstd, gzip",
+			body: func(t *testing.T) []byte {
+				return compress(t, "gzip", compress(t, "zstd", payload))
+			},
+			expectedCode: http.StatusOK,
+			expectedBody: string(payload),
+		},
+		{
+			name:            "identity",
+			contentEncoding: "identity",
+			body:            func(t *testing.T) []byte { return payload },
+			expectedCode:    http.StatusOK,
+			expectedBody:    string(payload),
+		},
+		{
+			name:            "no encoding",
+			contentEncoding: "",
+			body:            func(t *testing.T) []byte { return payload },
+			expectedCode:    http.StatusOK,
+			expectedBody:    string(payload),
+		},
+		{
+			name:            "unsupported encoding",
+			contentEncoding: "br",
+			body:            func(t *testing.T) []byte { return payload },
+			expectedCode:    http.StatusUnsupportedMediaType,
+		},
+		{
+			name:            "encoding not enabled",
+			contentEncoding: "zstd",
+			body:            func(t *testing.T) []byte { return compress(t, "zstd", payload) },
+			opts:            Options{Encodings: []string{EncodingGzip}},
+			expectedCode:    http.StatusUnsupportedMediaType,
+		},
+		{
+			name:            "decompression bomb",
+			contentEncoding: "gzip",
+			body: func(t *testing.T) []byte {
+				return compress(t, "gzip", bytes.Repeat([]byte{0}, 1<<20))
+			},
+			opts:         Options{MaxSize: 1024},
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:            "corrupt body",
+			contentEncoding: "gzip",
+			body:            func(t *testing.T) []byte { return []byte("not gzip at all") },
+			expectedCode:    http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody []byte
+			var gotEncoding string
+			var gotLength int64
+			handler := New(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotBody, _ = io.ReadAll(r.Body)
+				gotEncoding = r.Header.Get("Content-Encoding")
+				gotLength = r.ContentLength
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body(t)))
+			if tt.contentEncoding != "" {
+				req.Header.Set("Content-Encoding", tt.contentEncoding)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectedCode != http.StatusOK {
+				if !strings.Contains(rr.Header().Get("Content-Type"), "application/json") {
+					t.Error("error response is not JSON")
+				}
+				return
+			}
+
+			if string(gotBody) != tt.expectedBody {
+				t.Errorf("handler saw body %q, want %q", gotBody, tt.expectedBody)
+			}
+			if tt.contentEncoding != "" && tt.contentEncoding != "identity" {
+				if gotEncoding != "" {
+					t.Errorf("Content-Encoding %q was not removed", gotEncoding)
+				}
+				if gotLength != int64(len(tt.expectedBody)) {
+					t.Errorf("ContentLength = %d, want %d", gotLength, len(tt.expectedBody))
+				}
+			}
+		})
+	}
+}
+
+func TestDecompressAdvertisesSupportedEncodings(t *testing.T) {
+	handler := New(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("data"))
+	req.Header.Set("Content-Encoding", "compress")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Accept-Encoding"); got != "gzip, deflate, zstd" {
+		t.Errorf("Accept-Encoding = %q, want %q", got, "gzip, deflate, zstd")
+	}
+}
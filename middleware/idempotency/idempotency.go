@@ -0,0 +1,259 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHeader is the request header carrying the idempotency key
+	DefaultHeader = "Idempotency-Key"
+	// ReplayedHeader is set to "true" on replayed responses
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+var (
+	// ErrKeyMissing is reported when Required is set and a request has no key
+	ErrKeyMissing = errors.New("idempotency key is required")
+	// ErrKeyInvalid is reported for keys that are too long
+	ErrKeyInvalid = errors.New("idempotency key is invalid")
+	// ErrInFlight is reported when a request with the same key is still being handled
+	ErrInFlight = errors.New("a request with this idempotency key is in progress")
+	// ErrKeyReused is reported when a key is reused for a different request
+	ErrKeyReused = errors.New("idempotency key was used for a different request")
+	// ErrClaimLost is returned by a Store when a claim expired before the request finished
+	// and the key was claimed again or dropped
+	ErrClaimLost = errors.New("idempotency key claim was lost")
+)
+
+// Options configures the idempotency middleware
+type Options struct {
+	// Header names the request header carrying the key. Defaults to DefaultHeader.
+	Header string
+	// Methods lists the methods that honor keys. Defaults to POST and PATCH.
+	Methods []string
+	// Store holds records. Defaults to a new in-memory store.
+	Store Store
+	// TTL is how long responses are kept for replay. Defaults to 24 hours.
+	TTL time.Duration
+	// LockTTL bounds how long a request may hold its key before another request with the
+	// same key is allowed to run. A request running longer loses its claim and its response
+	// is not stored. Defaults to one minute.
+	LockTTL time.Duration
+	// Scope namespaces keys, for example by authenticated principal, so that clients cannot
+	// collide with or replay each other's keys. Keys are global when nil.
+	Scope func(r *http.Request) string
+	// Required rejects requests without a key with 400
+	Required bool
+	// MaxKeyLength is the longest accepted key. Defaults to 255.
+	MaxKeyLength int
+	// MaxBodySize bounds the request body read for fingerprinting. Larger bodies are
+	// rejected with 413. Defaults to 1 MiB.
+	MaxBodySize int64
+}
+
+// New returns a middleware that makes requests carrying an idempotency key safe to retry.
+// The first request with a key is handled and its response stored; later requests with the
+// same key and the same method, path and body receive the stored response, marked with
+// Idempotent-Replayed: true. A repeat that arrives while the first is still running gets
+// 409, and reusing a key for a different request gets 422. Responses with a 5xx status, and
+// handlers that panic, release the key so the request can be retried.
+func New(opts Options) func(http.Handler) http.Handler {
+	if opts.Header == "" {
+		opts.Header = DefaultHeader
+	}
+	if opts.Methods == nil {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = time.Minute
+	}
+	if opts.MaxKeyLength <= 0 {
+		opts.MaxKeyLength = 255
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+
+	methods := make(map[string]struct{}, len(opts.Methods))
+	for _, m := range opts.Methods {
+		methods[strings.ToUpper(m)] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := methods[r.Method]; !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.Header.Get(opts.Header)
+			if key == "" {
+				if opts.Required {
+					errorx.HandleError(w, r, errorx.BadRequestErr(ErrKeyMissing))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > opts.MaxKeyLength {
+				errorx.HandleError(w, r, errorx.BadRequestErr(ErrKeyInvalid))
+				return
+			}
+			if opts.Scope != nil {
+				key = opts.Scope(r) + ":" + key
+			}
+
+			fingerprint, err := fingerprintRequest(r, opts.MaxBodySize)
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					errorx.HandleError(w, r, errorx.PayloadTooLargeErr(err))
+					return
+				}
+				errorx.HandleError(w, r, errorx.BadRequestErr(fmt.Errorf("failed to read request body: %w", err)))
+				return
+			}
+
+			claim, existing, err := opts.Store.Begin(r.Context(), key, fingerprint, opts.LockTTL)
+			if err != nil {
+				errorx.HandleError(w, r, errorx.InternalServerErr(fmt.Errorf("idempotency store failed: %w", err)))
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.Fingerprint != fingerprint:
+					middleware.SetLogField(r.Context(), "idempotency", "key_reused")
+					errorx.HandleError(w, r, errorx.UnprocessableEntityErr(ErrKeyReused))
+				case existing.Response == nil:
+					middleware.SetLogField(r.Context(), "idempotency", "in_flight")
+					w.Header().Set("Retry-After", "1")
+					errorx.HandleError(w, r, errorx.ConflictErr(ErrInFlight))
+				default:
+					middleware.SetLogField(r.Context(), "idempotency", "replayed")
+					replay(w, existing.Response)
+				}
+				return
+			}
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				// Stores are written after the request may have been cancelled
+				ctx := context.WithoutCancel(r.Context())
+				var storeErr error
+				if completed {
+					storeErr = opts.Store.Complete(ctx, key, claim, rec.response(), opts.TTL)
+				} else {
+					storeErr = opts.Store.Release(ctx, key, claim)
+				}
+				switch {
+				case errors.Is(storeErr, ErrClaimLost):
+					middleware.SetLogField(r.Context(), "idempotency", "claim_lost")
+				case storeErr != nil:
+					middleware.SetLogField(r.Context(), "idempotency_store_error", storeErr.Error())
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+			completed = rec.status < http.StatusInternalServerError
+		})
+	}
+}
+
+// fingerprintRequest hashes the method, URI and body of r, restoring the body for the handler
+func fingerprintRequest(r *http.Request, maxBody int64) (string, error) {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.RequestURI())
+	h.Write([]byte{0})
+
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBody))
+		r.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		h.Write(body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replay writes a stored response. Headers already set by outer middleware, such as
+// X-Request-ID, are kept rather than replaced with the stored values.
+func replay(w http.ResponseWriter, resp *Response) {
+	dst := w.Header()
+	for k, v := range resp.Header {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+	dst.Set(ReplayedHeader, "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// recorder captures the response while passing it through to the client
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *recorder) WriteHeader(statusCode int) {
+	if !rec.wroteHeader {
+		rec.status = statusCode
+		rec.header = rec.ResponseWriter.Header().Clone()
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *recorder) Flush() {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func (rec *recorder) response() *Response {
+	header := rec.header
+	if header == nil {
+		header = rec.ResponseWriter.Header().Clone()
+	}
+	header.Del("Content-Length")
+	return &Response{Status: rec.status, Header: header, Body: bytes.Clone(rec.body.Bytes())}
+}
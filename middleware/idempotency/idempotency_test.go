@@ -0,0 +1,291 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRequest(method, target, key, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(DefaultHeader, key)
+	}
+	return req
+}
+
+func TestIdempotency(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          Options
+		first         *http.Request
+		second        *http.Request
+		handlerStatus int
+		expectedCode  int
+		expectedCalls int32
+		expectReplay  bool
+	}{
+		{
+			name:          "repeat is replayed",
+			first:         newRequest(http.MethodPost, "/orders", "abc", `{"qty":1}`),
+			second:        newRequest(http.MethodPost, "/orders", "abc", `{"qty":1}`),
+			handlerStatus: http.StatusCreated,
+			expectedCode:  http.StatusCreated,
+			expectedCalls: 1,
+			expectReplay:  true,
+		},
+		{
+			name:          "different body is rejected",
+			first:         newRequest(http.MethodPost, "/orders", "abc", `{"qty":1}`),
+			second:        newRequest(http.MethodPost, "/orders", "abc", `{"qty":2}`),
+			handlerStatus: http.StatusCreated,
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedCalls: 1,
+		},
+		{
+			name:          "different path is rejected",
+			first:         newRequest(http.MethodPost, "/orders", "abc", ""),
+			second:        newRequest(http.MethodPost, "/refunds", "abc", ""),
+			handlerStatus: http.StatusCreated,
+			expectedCode:  http.StatusUnprocessableEntity,
+			expectedCalls: 1,
+		},
+		{
+			name:          "different keys are handled separately",
+			first:         newRequest(http.MethodPost, "/orders", "abc", ""),
+			second:        newRequest(http.MethodPost, "/orders", "def", ""),
+			handlerStatus: http.StatusCreated,
+			expectedCode:  http.StatusCreated,
+			expectedCalls: 2,
+		},
+		{
+			name:          "requests without a key are not deduplicated",
+			first:         newRequest(http.MethodPost, "/orders", "", ""),
+			second:        newRequest(http.MethodPost, "/orders", "", ""),
+			handlerStatus: http.StatusCreated,
+			expectedCode:  http.StatusCreated,
+			expectedCalls: 2,
+		},
+		{
+			name:          "safe methods are ignored",
+			first:         newRequest(http.MethodGet, "/orders", "abc", ""),
+			second:        newRequest(http.MethodGet, "/orders", "abc", ""),
+			handlerStatus: http.StatusOK,
+			expectedCode:  http.StatusOK,
+			expectedCalls: 2,
+		},
+		{
+			name:          "server errors are retried",
+			first:         newRequest(http.MethodPost, "/orders", "abc", ""),
+			second:        newRequest(http.MethodPost, "/orders", "abc", ""),
+			handlerStatus: http.StatusBadGateway,
+			expectedCode:  http.StatusBadGateway,
+			expectedCalls: 2,
+		},
+		{
+			name:          "client errors are replayed",
+			first:         newRequest(http.MethodPatch, "/orders/1", "abc", ""),
+			second:        newRequest(http.MethodPatch, "/orders/1", "abc", ""),
+			handlerStatus: http.StatusBadRequest,
+			expectedCode:  http.StatusBadRequest,
+			expectedCalls: 1,
+			expectReplay:  true,
+		},
+		{
+			name:          "missing key rejected when required",
+			opts:          Options{Required: true},
+			first:         newRequest(http.MethodGet, "/orders", "", ""),
+			second:        newRequest(http.MethodPost, "/orders", "", ""),
+			handlerStatus: http.StatusCreated,
+			expectedCode:  http.StatusBadRequest,
+			expectedCalls: 1,
+		},
+		{
+			name: "scope separates clients",
+			opts: Options{Scope: func(r *http.Request) string {
+				return r.Header.Get("X-Client")
+			}},
+			first: func() *http.Request {
+				req := newRequest(http.MethodPost, "/orders", "abc", "")
+				req.Header.Set("X-Client", "a")
+				return req
+			}(),
+			second: func() *http.Request {
+				req := newRequest(http.MethodPost, "/orders", "abc", "")
+				req.Header.Set("X-Client", "b")
+				return req
+			}(),
+			handlerStatus: http.StatusCreated,
+			expectedCode:  http.StatusCreated,
+			expectedCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			handler := New(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				w.Header().Set("X-Call", string(rune('0'+n)))
+				w.WriteHeader(tt.handlerStatus)
+				w.Write([]byte("response"))
+			}))
+
+			first := httptest.NewRecorder()
+			handler.ServeHTTP(first, tt.first)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, tt.second)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if got := calls.Load(); got != tt.expectedCalls {
+				t.Errorf("handler called %d times, want %d", got, tt.expectedCalls)
+			}
+			if replayed := rr.Header().Get(ReplayedHeader) == "true"; replayed != tt.expectReplay {
+				t.Errorf("replayed = %v, want %v", replayed, tt.expectReplay)
+			}
+			if tt.expectReplay {
+				if rr.Body.String() != "response" || rr.Header().Get("X-Call") != "1" {
+					t.Errorf("replay = %q with X-Call %q, want the first response", rr.Body.String(), rr.Header().Get("X-Call"))
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := New(Options{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "/orders", "abc", ""))
+		close(done)
+	}()
+	<-entered
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost, "/orders", "abc", ""))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409 while in flight, got %d", rr.Code)
+	}
+
+	close(release)
+	<-done
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost, "/orders", "abc", ""))
+	if rr.Code != http.StatusCreated || rr.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("expected replayed 201 after completion, got %d", rr.Code)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	store := NewMemoryStore()
+	handler := New(Options{Store: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() { recover() }()
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "/orders", "abc", ""))
+	}()
+
+	if store.Len() != 0 {
+		t.Errorf("store holds %d keys after a panic, want 0", store.Len())
+	}
+}
+
+func TestIdempotencyBodyTooLarge(t *testing.T) {
+	handler := New(Options{MaxBodySize: 4})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost, "/orders", "abc", "too large"))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", rr.Code)
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	claim, rec, _ := store.Begin(ctx, "k", "fp", time.Second)
+	if rec != nil {
+		t.Fatal("expected first Begin to claim the key")
+	}
+	store.Complete(ctx, "k", claim, &Response{Status: http.StatusCreated}, time.Hour)
+
+	now = now.Add(30 * time.Minute)
+	if _, rec, _ := store.Begin(ctx, "k", "fp", time.Second); rec == nil || rec.Response == nil {
+		t.Fatal("expected stored response before the TTL")
+	}
+
+	now = now.Add(time.Hour)
+	if _, rec, _ := store.Begin(ctx, "k", "fp", time.Second); rec != nil {
+		t.Error("expected the key to be claimable after the TTL")
+	}
+}
+
+func TestIdempotencyLockExpiry(t *testing.T) {
+	now := time.Now()
+	var mu sync.Mutex
+	store := NewMemoryStore()
+	store.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	handler := New(Options{Store: store, LockTTL: time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(entered)
+			<-release
+			w.Write([]byte("first"))
+			return
+		}
+		w.Write([]byte("second"))
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest(http.MethodPost, "/orders", "abc", ""))
+		close(done)
+	}()
+	<-entered
+
+	// The slow request's lock expires and a retry claims the key
+	mu.Lock()
+	now = now.Add(2 * time.Second)
+	mu.Unlock()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost, "/orders", "abc", ""))
+	if rr.Body.String() != "second" {
+		t.Fatalf("retry after lock expiry body = %q, want second", rr.Body.String())
+	}
+
+	close(release)
+	<-done
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost, "/orders", "abc", ""))
+	if rr.Body.String() != "second" || rr.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("replay body = %q, want the retry's response", rr.Body.String())
+	}
+}
@@ -0,0 +1,134 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Response is a stored response, replayed for repeated requests
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record is the state of an idempotency key
+type Record struct {
+	// Fingerprint identifies the request that first used the key
+	Fingerprint string
+	// Response is nil while the first request is still being handled
+	Response *Response
+}
+
+// Store holds idempotency records. Implementations must make Begin atomic so that only one
+// of several concurrent requests with the same key is handled, possibly across processes.
+// Claims are identified by a token so that a request whose claim expired cannot overwrite
+// the record of the request that claimed the key after it.
+type Store interface {
+	// Begin claims key for a request with the given fingerprint, holding the claim for at
+	// most lockTTL. It returns a token identifying the claim if the key was claimed, or the
+	// existing record otherwise.
+	Begin(ctx context.Context, key, fingerprint string, lockTTL time.Duration) (string, *Record, error)
+	// Complete stores the response for key, keeping it for ttl. It returns ErrClaimLost
+	// unless claim still holds the key.
+	Complete(ctx context.Context, key, claim string, resp *Response, ttl time.Duration) error
+	// Release drops claim without storing a response, so the request can be retried. It
+	// returns ErrClaimLost unless claim still holds the key.
+	Release(ctx context.Context, key, claim string) error
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is an in-process Store. Expired records are swept lazily.
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[string]*memoryRecord
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryRecord struct {
+	Record
+	claim   string
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*memoryRecord), now: time.Now}
+}
+
+// Begin claims key unless an unexpired record already holds it
+func (s *MemoryStore) Begin(_ context.Context, key, fingerprint string, lockTTL time.Duration) (string, *Record, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, rec := range s.records {
+			if now.After(rec.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if rec, ok := s.records[key]; ok && !now.After(rec.expires) {
+		existing := rec.Record
+		return "", &existing, nil
+	}
+	claim := newClaim()
+	s.records[key] = &memoryRecord{
+		Record:  Record{Fingerprint: fingerprint},
+		claim:   claim,
+		expires: now.Add(lockTTL),
+	}
+	return claim, nil, nil
+}
+
+// Complete stores resp for key and extends its expiry to ttl
+func (s *MemoryStore) Complete(_ context.Context, key, claim string, resp *Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok || rec.claim != claim || rec.Response != nil {
+		return ErrClaimLost
+	}
+	rec.Response = resp
+	rec.expires = s.now().Add(ttl)
+	return nil
+}
+
+// Release removes key if claim holds it and it has no stored response
+func (s *MemoryStore) Release(_ context.Context, key, claim string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok || rec.claim != claim || rec.Response != nil {
+		return ErrClaimLost
+	}
+	delete(s.records, key)
+	return nil
+}
+
+func newClaim() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("idempotency: failed to generate claim: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Len returns the number of tracked keys
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.records)
+}
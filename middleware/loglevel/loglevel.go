@@ -0,0 +1,160 @@
+package loglevel
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/httpx"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DefaultHeader raises the log level of a single request when authorized
+const DefaultHeader = "X-Debug-Log"
+
+var logger = logx.Named("loglevel")
+
+// Options configures the per-request override middleware
+type Options struct {
+	// Header names the request header that raises verbosity. Defaults to DefaultHeader.
+	Header string
+	// Level is the level an authorized request logs at. Defaults to debug.
+	Level zerolog.Level
+	// Authorize decides whether the request may raise its verbosity, given the header
+	// value. It is required; Tokens covers the common case.
+	Authorize func(r *http.Request, value string) bool
+}
+
+// Tokens returns an Authorize function accepting requests whose header carries one of
+// tokens
+func Tokens(tokens ...string) func(r *http.Request, value string) bool {
+	return func(_ *http.Request, value string) bool {
+		ok := 0
+		for _, token := range tokens {
+			ok |= subtle.ConstantTimeCompare([]byte(value), []byte(token))
+		}
+		return ok == 1
+	}
+}
+
+// Override returns a middleware that lowers the log level to Level for requests carrying
+// an authorized header, for mjolnir's loggers and for the zerolog logger it attaches to
+// every request context, which handlers retrieve with zerolog.Ctx. That logger writes
+// through the Logger set with logx.SetLogger. Other requests are unaffected. Unauthorized
+// headers are ignored. It panics if Authorize is nil.
+func Override(opts Options) func(http.Handler) http.Handler {
+	if opts.Authorize == nil {
+		panic("loglevel: Authorize is required")
+	}
+	if opts.Header == "" {
+		opts.Header = DefaultHeader
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if value := r.Header.Get(opts.Header); value != "" {
+				if opts.Authorize(r, value) {
+					ctx = logx.WithLevel(ctx, opts.Level)
+					middleware.SetLogField(ctx, "log_level", opts.Level.String())
+				} else {
+					logger.Warn(ctx, "ignoring unauthorized log level override",
+						slog.String("request_id", middleware.GetRequestID(ctx)))
+				}
+			}
+
+			l := logx.ZerologFor(ctx).With().
+				Str("request_id", middleware.GetRequestID(ctx)).
+				Ctx(ctx).
+				Logger()
+			next.ServeHTTP(w, r.WithContext(l.WithContext(ctx)))
+		})
+	}
+}
+
+// levelRequest is the body of a PUT to Handler
+type levelRequest struct {
+	Level string `json:"level"`
+	// RevertAfter is a duration such as "15m" after which the previous level is restored
+	RevertAfter string `json:"revert_after,omitempty"`
+}
+
+// Handler returns an admin API for runtime log levels, to be mounted behind
+// authentication, for example with r.With(auth.New(opts)).Mount("/admin/log", Handler()):
+//
+//	GET    /        list the global level and every named logger
+//	GET    /{name}  describe one logger; "global" is the global level
+//	PUT    /{name}  set a level: {"level": "debug", "revert_after": "15m"}
+//	DELETE /{name}  reset a logger to the global level, or the global level to its default
+func Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		httpx.RespondJSON(w, r, http.StatusOK, logx.Levels())
+	})
+	r.Get("/{name}", errorx.ErrorHandler(getLevel))
+	r.Put("/{name}", errorx.ErrorHandler(putLevel))
+	r.Delete("/{name}", errorx.ErrorHandler(deleteLevel))
+	return r
+}
+
+func getLevel(w http.ResponseWriter, r *http.Request) *errorx.ApiError {
+	name := chi.URLParam(r, "name")
+	info, ok := logx.LookupLevel(name)
+	if !ok {
+		return errorx.NewApiError(fmt.Errorf("unknown logger %q", name), http.StatusNotFound)
+	}
+	httpx.RespondJSON(w, r, http.StatusOK, info)
+	return nil
+}
+
+func putLevel(w http.ResponseWriter, r *http.Request) *errorx.ApiError {
+	var req levelRequest
+	if _, err := httpx.DecodeJSON(r, &req); err != nil {
+		return errorx.BadRequestErr(err)
+	}
+	level, err := zerolog.ParseLevel(req.Level)
+	if err != nil || req.Level == "" {
+		return errorx.BadRequestErr(fmt.Errorf("invalid level %q", req.Level))
+	}
+	var revertAfter time.Duration
+	if req.RevertAfter != "" {
+		revertAfter, err = time.ParseDuration(req.RevertAfter)
+		if err != nil || revertAfter <= 0 {
+			return errorx.BadRequestErr(errors.New("revert_after must be a positive duration such as 15m"))
+		}
+	}
+
+	name := chi.URLParam(r, "name")
+	logx.SetLevel(name, level, revertAfter)
+	info, _ := logx.LookupLevel(name)
+	logger.Info(r.Context(), "log level changed",
+		slog.String("request_id", middleware.GetRequestID(r.Context())),
+		slog.String("logger", name),
+		slog.String("level", info.Level),
+		slog.Duration("revert_after", revertAfter))
+
+	httpx.RespondJSON(w, r, http.StatusOK, info)
+	return nil
+}
+
+func deleteLevel(w http.ResponseWriter, r *http.Request) *errorx.ApiError {
+	name := chi.URLParam(r, "name")
+	if _, ok := logx.LookupLevel(name); !ok {
+		return errorx.NewApiError(fmt.Errorf("unknown logger %q", name), http.StatusNotFound)
+	}
+	logx.ResetLevel(name)
+	info, _ := logx.LookupLevel(name)
+	logger.Info(r.Context(), "log level reset",
+		slog.String("request_id", middleware.GetRequestID(r.Context())),
+		slog.String("logger", name),
+		slog.String("level", info.Level))
+
+	httpx.RespondJSON(w, r, http.StatusOK, info)
+	return nil
+}
@@ -0,0 +1,193 @@
+package loglevel
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOverride(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		expectedLogs []string
+		unwantedLogs []string
+	}{
+		{
+			name:         "no header",
+			unwantedLogs: []string{"handler debug", "library debug"},
+		},
+		{
+			name:         "authorized header",
+			header:       "let-me-in",
+			expectedLogs: []string{"handler debug", "library debug", `"request_id":"req-1"`},
+		},
+		{
+			name:         "unauthorized header",
+			header:       "guess",
+			expectedLogs: []string{"ignoring unauthorized log level override"},
+			unwantedLogs: []string{"handler debug", "library debug"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.Logger = zerolog.New(&buf)
+			logx.SetLevel(logx.Global, zerolog.InfoLevel, 0)
+			defer logx.ResetLevel(logx.Global)
+
+			handler := middleware.RequestID(Override(Options{Authorize: Tokens("let-me-in")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				zerolog.Ctx(r.Context()).Debug().Msg("handler debug")
+				logx.Debug(r.Context(), "library debug")
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(DefaultHeader, tt.header)
+			}
+			req.Header.Set("X-Request-ID", "req-1")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			logStr := buf.String()
+			for _, expected := range tt.expectedLogs {
+				if !strings.Contains(logStr, expected) {
+					t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+				}
+			}
+			for _, unwanted := range tt.unwantedLogs {
+				if strings.Contains(logStr, unwanted) {
+					t.Errorf("log contains %q\nLog: %s", unwanted, logStr)
+				}
+			}
+		})
+	}
+}
+
+func TestOverrideWithSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logx.SetLogger(logx.Slog(slog.NewJSONHandler(&buf, nil)))
+	defer logx.SetLogger(nil)
+
+	handler := middleware.RequestID(Override(Options{Authorize: Tokens("let-me-in")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zerolog.Ctx(r.Context()).Debug().Int("attempt", 2).Msg("handler debug")
+		logx.Debug(r.Context(), "library debug")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if buf.Len() != 0 {
+		t.Errorf("debug logged without an override\nLog: %s", buf.String())
+	}
+
+	req.Header.Set(DefaultHeader, "let-me-in")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	logStr := buf.String()
+	for _, expected := range []string{`"msg":"handler debug","attempt":2,"request_id":"req-1"`, `"msg":"library debug"`} {
+		if !strings.Contains(logStr, expected) {
+			t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+		}
+	}
+}
+
+func TestOverrideRequiresAuthorize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic without Authorize")
+		}
+	}()
+	Override(Options{})
+}
+
+func TestHandler(t *testing.T) {
+	log.Logger = zerolog.New(nil)
+	defer logx.ResetLevel("handler-test")
+	h := Handler()
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "unknown logger",
+			method:       http.MethodGet,
+			path:         "/handler-test",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "set level",
+			method:       http.MethodPut,
+			path:         "/handler-test",
+			body:         `{"level":"warn","revert_after":"1h"}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `"level":"warn"`,
+		},
+		{
+			name:         "get level",
+			method:       http.MethodGet,
+			path:         "/handler-test",
+			expectedCode: http.StatusOK,
+			expectedBody: `"revert_at":`,
+		},
+		{
+			name:         "list levels",
+			method:       http.MethodGet,
+			path:         "/",
+			expectedCode: http.StatusOK,
+			expectedBody: `{"name":"handler-test","level":"warn"`,
+		},
+		{
+			name:         "invalid level",
+			method:       http.MethodPut,
+			path:         "/handler-test",
+			body:         `{"level":"loud"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "invalid revert",
+			method:       http.MethodPut,
+			path:         "/handler-test",
+			body:         `{"level":"info","revert_after":"soon"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "reset level",
+			method:       http.MethodDelete,
+			path:         "/handler-test",
+			expectedCode: http.StatusOK,
+			expectedBody: `"inherited":true`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("status = %d, want %d: %s", rr.Code, tt.expectedCode, rr.Body.String())
+			}
+			if !json.Valid(rr.Body.Bytes()) {
+				t.Errorf("body is not JSON: %s", rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("body doesn't contain %q: %s", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
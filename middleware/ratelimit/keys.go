@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// KeyFunc derives the rate limiting key for a request
+type KeyFunc func(r *http.Request) string
+
+// KeyByIP keys requests by client IP address, as resolved by the TrustedProxies
+// middleware when present and otherwise taken from the immediate peer
+func KeyByIP(r *http.Request) string {
+	return "ip:" + middleware.ClientIP(r)
+}
+
+// KeyByAPIKey keys requests by the value of the given header. Requests without the header
+// are not limited unless combined with another key using Fallback.
+func KeyByAPIKey(header string) KeyFunc {
+	return func(r *http.Request) string {
+		if key := r.Header.Get(header); key != "" {
+			return "key:" + key
+		}
+		return ""
+	}
+}
+
+// KeyByPrincipal keys requests by the authenticated principal returned by identify.
+// Unauthenticated requests, for which identify returns an empty string, are not limited
+// unless combined with another key using Fallback.
+func KeyByPrincipal(identify func(r *http.Request) string) KeyFunc {
+	return func(r *http.Request) string {
+		if id := identify(r); id != "" {
+			return "principal:" + id
+		}
+		return ""
+	}
+}
+
+// KeyByRoute keys requests by method and matched chi route pattern, so that all clients
+// share one limit per route. Routing is only complete inside the route handler, so apply
+// it with chi's With or inside a route group rather than on the root router.
+func KeyByRoute(r *http.Request) string {
+	pattern := r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if p := rctx.RoutePattern(); p != "" {
+			pattern = p
+		}
+	}
+	return "route:" + r.Method + " " + pattern
+}
+
+// Fallback uses the first key function that returns a non-empty key
+func Fallback(keys ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, key := range keys {
+			if k := key(r); k != "" {
+				return k
+			}
+		}
+		return ""
+	}
+}
+
+// Compose joins the keys of every function, limiting each combination separately, such
+// as per client per route. If any function returns an empty key the request is not limited.
+func Compose(keys ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		composed := ""
+		for i, key := range keys {
+			k := key(r)
+			if k == "" {
+				return ""
+			}
+			if i > 0 {
+				composed += "|"
+			}
+			composed += k
+		}
+		return composed
+	}
+}
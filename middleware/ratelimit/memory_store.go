@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"hash/maphash"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultShards = 32
+	sweepInterval = time.Minute
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is an in-process Store that spreads keys across independently locked
+// shards to reduce contention. Idle entries are swept lazily.
+type MemoryStore struct {
+	seed   maphash.Seed
+	shards []*shard
+	now    func() time.Time
+}
+
+type shard struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// entry holds the state of either algorithm for a single key
+type entry struct {
+	// token bucket
+	tokens     float64
+	lastRefill time.Time
+
+	// sliding window
+	windowStart time.Time
+	current     int
+	previous    int
+
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*shard, defaultShards),
+		now:    time.Now,
+	}
+	for i := range s.shards {
+		s.shards[i] = &shard{entries: make(map[string]*entry)}
+	}
+	return s
+}
+
+// Take counts a request for key against limit
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+	sh := s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if now.Sub(sh.lastSweep) > sweepInterval {
+		sh.sweep(now)
+	}
+
+	e, ok := sh.entries[key]
+	if !ok {
+		e = &entry{}
+		sh.entries[key] = e
+	}
+
+	if limit.Algorithm == SlidingWindow {
+		return e.takeWindow(now, limit), nil
+	}
+	return e.takeToken(now, limit), nil
+}
+
+// Len returns the number of tracked keys
+func (s *MemoryStore) Len() int {
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += len(sh.entries)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+func (sh *shard) sweep(now time.Time) {
+	for key, e := range sh.entries {
+		if now.After(e.expires) {
+			delete(sh.entries, key)
+		}
+	}
+	sh.lastSweep = now
+}
+
+func (e *entry) takeToken(now time.Time, limit Limit) Result {
+	capacity := float64(limit.capacity())
+	perToken := limit.Period / time.Duration(limit.Rate)
+
+	if e.lastRefill.IsZero() {
+		e.tokens = capacity
+	} else {
+		elapsed := now.Sub(e.lastRefill)
+		e.tokens = math.Min(capacity, e.tokens+float64(elapsed)/float64(perToken))
+	}
+	e.lastRefill = now
+
+	res := Result{Limit: int(capacity)}
+	if e.tokens >= 1 {
+		e.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - e.tokens) * float64(perToken))
+	}
+
+	res.Remaining = int(e.tokens)
+	res.Reset = time.Duration((capacity - e.tokens) * float64(perToken))
+	e.expires = now.Add(res.Reset)
+	return res
+}
+
+func (e *entry) takeWindow(now time.Time, limit Limit) Result {
+	period := limit.Period
+	if e.windowStart.IsZero() {
+		e.windowStart = now.Truncate(period)
+	}
+
+	// Roll the window forward, discarding counts older than one full period
+	if elapsed := now.Sub(e.windowStart); elapsed >= period {
+		windows := elapsed / period
+		if windows == 1 {
+			e.previous = e.current
+		} else {
+			e.previous = 0
+		}
+		e.current = 0
+		e.windowStart = e.windowStart.Add(windows * period)
+	}
+
+	elapsed := now.Sub(e.windowStart)
+	weight := 1 - float64(elapsed)/float64(period)
+	estimate := float64(e.previous)*weight + float64(e.current)
+
+	res := Result{Limit: limit.Rate, Reset: period - elapsed}
+	if estimate+1 <= float64(limit.Rate) {
+		e.current++
+		estimate++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = e.windowRetryAfter(elapsed, limit)
+	}
+
+	res.Remaining = max(int(float64(limit.Rate)-estimate), 0)
+	if e.current > 0 {
+		res.Reset = 2*period - elapsed
+	}
+	e.expires = e.windowStart.Add(2 * period)
+	return res
+}
+
+// windowRetryAfter estimates when the weighted count will drop enough to admit a request
+func (e *entry) windowRetryAfter(elapsed time.Duration, limit Limit) time.Duration {
+	period := limit.Period
+	room := float64(limit.Rate - e.current - 1)
+	if room >= 0 && e.previous > 0 {
+		// previous * (1 - t/period) <= room  =>  t >= period * (1 - room/previous)
+		t := time.Duration(float64(period) * (1 - room/float64(e.previous)))
+		if t > elapsed {
+			return t - elapsed
+		}
+	}
+
+	// The current window alone is full; wait for it to become the previous window and
+	// decay enough to admit one more request
+	untilRoll := period - elapsed
+	if e.current > 0 {
+		decay := time.Duration(float64(period) * (1 - float64(limit.Rate-1)/float64(e.current)))
+		return untilRoll + max(decay, 0)
+	}
+	return untilRoll
+}
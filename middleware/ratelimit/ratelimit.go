@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var logger = logx.Named("ratelimit")
+
+// Algorithm selects how requests are counted against a Limit
+type Algorithm int
+
+const (
+	// TokenBucket refills Rate tokens per Period up to Burst, allowing short bursts
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Rate requests in any Period, weighting the previous window
+	SlidingWindow
+)
+
+// Limit describes how many requests a key may make
+type Limit struct {
+	Algorithm Algorithm
+	// Rate is the number of requests allowed per Period
+	Rate   int
+	Period time.Duration
+	// Burst is the token bucket capacity. Defaults to Rate; ignored by SlidingWindow.
+	Burst int
+}
+
+// PerSecond allows rate requests per second, counted with algorithm
+func PerSecond(rate int, algorithm Algorithm) Limit {
+	return Limit{Algorithm: algorithm, Rate: rate, Period: time.Second}
+}
+
+// PerMinute allows rate requests per minute, counted with algorithm
+func PerMinute(rate int, algorithm Algorithm) Limit {
+	return Limit{Algorithm: algorithm, Rate: rate, Period: time.Minute}
+}
+
+func (l Limit) capacity() int {
+	if l.Algorithm == TokenBucket && l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// Result is the outcome of counting a request against a Limit
+type Result struct {
+	Allowed bool
+	// Limit is the maximum number of requests available at once
+	Limit int
+	// Remaining is the number of requests still available
+	Remaining int
+	// Reset is the time until the quota is fully restored
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed, when denied
+	RetryAfter time.Duration
+}
+
+// Store tracks request counts. Implementations must apply the limit atomically so that
+// concurrent requests for the same key, possibly across processes, are counted correctly.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Options configures the rate limiting middleware
+type Options struct {
+	Limit Limit
+	// Key identifies the client a request is counted against. Requests for which it returns
+	// an empty string are not limited. Defaults to KeyByIP.
+	Key KeyFunc
+	// Store holds the counters. Defaults to a new in-memory store.
+	Store Store
+	// Name namespaces keys so that several limiters can share a store
+	Name string
+	// FailClosed rejects requests when the store returns an error instead of allowing them
+	FailClosed bool
+}
+
+// New returns a middleware that limits requests per key, setting RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy on every response and
+// rejecting requests over the limit with 429 and Retry-After.
+func New(opts Options) func(http.Handler) http.Handler {
+	if opts.Limit.Rate <= 0 || opts.Limit.Period <= 0 {
+		panic("ratelimit: Limit requires a positive Rate and Period")
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	policy := fmt.Sprintf("%d;w=%d", opts.Limit.Rate, int(math.Ceil(opts.Limit.Period.Seconds())))
+	if opts.Limit.Algorithm == TokenBucket && opts.Limit.Burst > 0 {
+		policy += ";burst=" + strconv.Itoa(opts.Limit.Burst)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if opts.Name != "" {
+				key = opts.Name + ":" + key
+			}
+
+			res, err := opts.Store.Take(r.Context(), key, opts.Limit)
+			if err != nil {
+				if opts.FailClosed {
+					errorx.HandleError(w, r, errorx.InternalServerErr(fmt.Errorf("rate limit store failed: %w", err)))
+					return
+				}
+				logger.Warn(r.Context(), "rate limit store failed, allowing request",
+					slog.String("request_id", middleware.GetRequestID(r.Context())),
+					logx.Err(err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			h.Set("RateLimit-Policy", policy)
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+				middleware.SetLogField(r.Context(), "rate_limited", true)
+				errorx.HandleError(w, r, errorx.TooManyRequestsErr(errors.New("rate limit exceeded")))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
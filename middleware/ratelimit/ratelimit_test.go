@@ -0,0 +1,259 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	return store, clock
+}
+
+func TestTokenBucket(t *testing.T) {
+	store, clock := newTestStore()
+	limit := Limit{Algorithm: TokenBucket, Rate: 2, Period: time.Second, Burst: 4}
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		res, _ := store.Take(ctx, "k", limit)
+		if !res.Allowed {
+			t.Fatalf("request %d within burst was denied", i+1)
+		}
+		if res.Remaining != 3-i {
+			t.Errorf("request %d: Remaining = %d, want %d", i+1, res.Remaining, 3-i)
+		}
+	}
+
+	res, _ := store.Take(ctx, "k", limit)
+	if res.Allowed {
+		t.Fatal("request beyond burst was allowed")
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 500ms", res.RetryAfter)
+	}
+	if res.Limit != 4 {
+		t.Errorf("Limit = %d, want 4", res.Limit)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if res, _ := store.Take(ctx, "k", limit); !res.Allowed {
+		t.Error("request after refill was denied")
+	}
+
+	if res, _ := store.Take(ctx, "other", limit); !res.Allowed {
+		t.Error("keys are not limited independently")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store, clock := newTestStore()
+	limit := Limit{Algorithm: SlidingWindow, Rate: 10, Period: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		if res, _ := store.Take(ctx, "k", limit); !res.Allowed {
+			t.Fatalf("request %d within limit was denied", i+1)
+		}
+	}
+
+	res, _ := store.Take(ctx, "k", limit)
+	if res.Allowed {
+		t.Fatal("request beyond limit was allowed")
+	}
+	if res.Remaining != 0 {
+		t.Errorf("Remaining = %d, want 0", res.Remaining)
+	}
+	if res.RetryAfter <= time.Minute || res.RetryAfter > 2*time.Minute {
+		t.Errorf("RetryAfter = %v, want between 1m and 2m", res.RetryAfter)
+	}
+
+	// Halfway through the next window half of the previous window still counts
+	clock.Advance(90 * time.Second)
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if res, _ := store.Take(ctx, "k", limit); res.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("allowed %d requests halfway through the next window, want 5", allowed)
+	}
+
+	// After two full idle windows the key starts fresh
+	clock.Advance(3 * time.Minute)
+	if res, _ := store.Take(ctx, "k", limit); !res.Allowed || res.Remaining != 9 {
+		t.Errorf("expected fresh window, got %+v", res)
+	}
+}
+
+func TestMemoryStoreSweepsIdleEntries(t *testing.T) {
+	store, clock := newTestStore()
+	limit := PerSecond(1, TokenBucket)
+
+	store.Take(context.Background(), "a", limit)
+	store.Take(context.Background(), "b", limit)
+	if store.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", store.Len())
+	}
+
+	clock.Advance(2 * sweepInterval)
+	for i := 0; i < 64; i++ {
+		store.Take(context.Background(), string(rune('c'+i)), limit)
+	}
+	clock.Advance(2 * sweepInterval)
+	store.Take(context.Background(), "z", limit)
+
+	if store.Len() >= 66 {
+		t.Errorf("idle entries were not swept, Len() = %d", store.Len())
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Algorithm: SlidingWindow, Rate: 100, Period: time.Hour}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, _ := store.Take(context.Background(), "shared", limit); res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 100 {
+		t.Errorf("allowed %d concurrent requests, want exactly 100", allowed)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := New(Options{Limit: Limit{Algorithm: TokenBucket, Rate: 2, Period: time.Minute}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := send("10.0.0.1:1234")
+	if first.Code != http.StatusOK {
+		t.Fatalf("first request got status %d", first.Code)
+	}
+	if first.Header().Get("RateLimit-Limit") != "2" || first.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("unexpected rate limit headers: %v", first.Header())
+	}
+	if first.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("RateLimit-Policy = %q, want %q", first.Header().Get("RateLimit-Policy"), "2;w=60")
+	}
+
+	send("10.0.0.1:5678")
+	denied := send("10.0.0.1:9999")
+	if denied.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", denied.Code)
+	}
+	if denied.Header().Get("Retry-After") != "30" {
+		t.Errorf("Retry-After = %q, want 30", denied.Header().Get("Retry-After"))
+	}
+	if denied.Header().Get("Content-Type") != "application/json" {
+		t.Error("429 response is not rendered as a JSON error")
+	}
+
+	if other := send("10.0.0.2:1234"); other.Code != http.StatusOK {
+		t.Errorf("different client was limited, got status %d", other.Code)
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("store unavailable")
+}
+
+func TestMiddlewareStoreFailure(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		failClosed   bool
+		expectedCode int
+	}{
+		{name: "fail open", failClosed: false, expectedCode: http.StatusOK},
+		{name: "fail closed", failClosed: true, expectedCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(Options{Limit: PerSecond(1, TokenBucket), Store: failingStore{}, FailClosed: tt.failClosed})(next)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+	req.RemoteAddr = "192.0.2.1:4321"
+	req.Header.Set("X-API-Key", "secret")
+
+	if got := KeyByIP(req); got != "ip:192.0.2.1" {
+		t.Errorf("KeyByIP() = %q", got)
+	}
+	if got := KeyByAPIKey("X-API-Key")(req); got != "key:secret" {
+		t.Errorf("KeyByAPIKey() = %q", got)
+	}
+	if got := KeyByAPIKey("X-Missing")(req); got != "" {
+		t.Errorf("KeyByAPIKey() for missing header = %q, want empty", got)
+	}
+	if got := KeyByRoute(req); got != "route:GET /items/1" {
+		t.Errorf("KeyByRoute() = %q", got)
+	}
+
+	principal := KeyByPrincipal(func(r *http.Request) string { return "" })
+	if got := Fallback(principal, KeyByIP)(req); got != "ip:192.0.2.1" {
+		t.Errorf("Fallback() = %q", got)
+	}
+	if got := Compose(KeyByIP, KeyByRoute)(req); got != "ip:192.0.2.1|route:GET /items/1" {
+		t.Errorf("Compose() = %q", got)
+	}
+	if got := Compose(KeyByIP, principal)(req); got != "" {
+		t.Errorf("Compose() with empty component = %q, want empty", got)
+	}
+}
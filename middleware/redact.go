@@ -0,0 +1,278 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultRedactionMask replaces redacted values
+const DefaultRedactionMask = "[REDACTED]"
+
+var (
+	// DefaultRedactedHeaders are masked when RedactOptions.Headers is nil
+	DefaultRedactedHeaders = []string{
+		"Authorization",
+		"Proxy-Authorization",
+		"Cookie",
+		"Set-Cookie",
+		"X-Api-Key",
+		"X-Csrf-Token",
+	}
+	// DefaultRedactedQueryParams are masked when RedactOptions.QueryParams is nil
+	DefaultRedactedQueryParams = []string{"access_token", "api_key", "apikey", "token", "password", "secret"}
+	// DefaultRedactedFields are masked when RedactOptions.Fields is nil
+	DefaultRedactedFields = []string{
+		"password",
+		"secret",
+		"token",
+		"access_token",
+		"refresh_token",
+		"client_secret",
+	}
+)
+
+// Redactor decides what is logged in place of potentially sensitive values. Implementations
+// return the value to log and whether it was changed, and must be safe for concurrent use.
+type Redactor interface {
+	// Header redacts the value of a request or response header
+	Header(name, value string) (string, bool)
+	// Query redacts the value of a query parameter
+	Query(name, value string) (string, bool)
+	// Field redacts a log field or JSON body member. path holds the names of the enclosing
+	// objects and the member itself; array elements are named "*".
+	Field(path []string, value any) (any, bool)
+}
+
+// RedactOptions configures the Redactor returned by NewRedactor
+type RedactOptions struct {
+	// Headers lists header names to mask. Defaults to DefaultRedactedHeaders.
+	Headers []string
+	// QueryParams lists query parameter names to mask. Defaults to DefaultRedactedQueryParams.
+	QueryParams []string
+	// Fields lists log field and JSON member paths to mask, such as "user.ssn" or
+	// "cards.*.number". A path without dots matches that name at any depth. Matching is
+	// case-insensitive. Defaults to DefaultRedactedFields.
+	Fields []string
+	// NamePatterns mask headers, query parameters and fields whose names match
+	NamePatterns []*regexp.Regexp
+	// ValuePatterns mask matching parts of any string value, such as card numbers
+	ValuePatterns []*regexp.Regexp
+	// Mask replaces redacted values. Defaults to DefaultRedactionMask.
+	Mask string
+}
+
+type redactor struct {
+	headers       map[string]struct{}
+	queryParams   map[string]struct{}
+	names         map[string]struct{}
+	paths         [][]string
+	namePatterns  []*regexp.Regexp
+	valuePatterns []*regexp.Regexp
+	mask          string
+}
+
+// NewRedactor returns a Redactor masking the names and patterns in opts
+func NewRedactor(opts RedactOptions) Redactor {
+	if opts.Headers == nil {
+		opts.Headers = DefaultRedactedHeaders
+	}
+	if opts.QueryParams == nil {
+		opts.QueryParams = DefaultRedactedQueryParams
+	}
+	if opts.Fields == nil {
+		opts.Fields = DefaultRedactedFields
+	}
+	if opts.Mask == "" {
+		opts.Mask = DefaultRedactionMask
+	}
+
+	rd := &redactor{
+		headers:       make(map[string]struct{}),
+		queryParams:   make(map[string]struct{}),
+		names:         make(map[string]struct{}),
+		namePatterns:  opts.NamePatterns,
+		valuePatterns: opts.ValuePatterns,
+		mask:          opts.Mask,
+	}
+	for _, h := range opts.Headers {
+		rd.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	for _, q := range opts.QueryParams {
+		rd.queryParams[strings.ToLower(q)] = struct{}{}
+	}
+	for _, f := range opts.Fields {
+		f = strings.ToLower(f)
+		if strings.Contains(f, ".") {
+			rd.paths = append(rd.paths, strings.Split(f, "."))
+		} else {
+			rd.names[f] = struct{}{}
+		}
+	}
+	return rd
+}
+
+func (rd *redactor) Header(name, value string) (string, bool) {
+	if _, ok := rd.headers[http.CanonicalHeaderKey(name)]; ok || rd.matchesName(name) {
+		return rd.mask, true
+	}
+	return rd.redactValue(value)
+}
+
+func (rd *redactor) Query(name, value string) (string, bool) {
+	if _, ok := rd.queryParams[strings.ToLower(name)]; ok || rd.matchesName(name) {
+		return rd.mask, true
+	}
+	return rd.redactValue(value)
+}
+
+func (rd *redactor) Field(path []string, value any) (any, bool) {
+	if len(path) > 0 {
+		name := strings.ToLower(path[len(path)-1])
+		if _, ok := rd.names[name]; ok || rd.matchesName(name) || rd.matchesPath(path) {
+			return rd.mask, true
+		}
+	}
+	if s, ok := value.(string); ok {
+		return rd.redactValue(s)
+	}
+	return value, false
+}
+
+func (rd *redactor) matchesName(name string) bool {
+	for _, re := range rd.namePatterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rd *redactor) matchesPath(path []string) bool {
+	for _, pattern := range rd.paths {
+		if len(pattern) != len(path) {
+			continue
+		}
+		matched := true
+		for i, p := range pattern {
+			if p != "*" && p != strings.ToLower(path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (rd *redactor) redactValue(value string) (string, bool) {
+	redacted := value
+	for _, re := range rd.valuePatterns {
+		redacted = re.ReplaceAllLiteralString(redacted, rd.mask)
+	}
+	return redacted, redacted != value
+}
+
+type redactorHolder struct {
+	Redactor
+}
+
+var currentRedactor atomic.Pointer[redactorHolder]
+
+func init() {
+	SetRedactor(nil)
+}
+
+// SetRedactor replaces the Redactor used by RequestLogger and errorx. A nil
+// Redactor restores the default, NewRedactor(RedactOptions{}).
+func SetRedactor(rd Redactor) {
+	if rd == nil {
+		rd = NewRedactor(RedactOptions{})
+	}
+	currentRedactor.Store(&redactorHolder{rd})
+}
+
+// GetRedactor returns the Redactor set with SetRedactor
+func GetRedactor() Redactor {
+	return currentRedactor.Load().Redactor
+}
+
+// RedactHeaders returns a copy of h with sensitive values masked
+func RedactHeaders(rd Redactor, h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		out := make([]string, len(values))
+		for i, v := range values {
+			out[i], _ = rd.Header(name, v)
+		}
+		redacted[name] = out
+	}
+	return redacted
+}
+
+// RedactQuery returns rawQuery with sensitive parameter values masked. Malformed pairs
+// are dropped.
+func RedactQuery(rd Redactor, rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	values, _ := url.ParseQuery(rawQuery)
+	for name, vs := range values {
+		for i, v := range vs {
+			vs[i], _ = rd.Query(name, v)
+		}
+	}
+	return values.Encode()
+}
+
+// RedactFields returns a copy of log fields with sensitive values masked
+func RedactFields(rd Redactor, fields map[string]any) map[string]any {
+	redacted := make(map[string]any, len(fields))
+	for k, v := range fields {
+		redacted[k], _ = rd.Field([]string{k}, v)
+	}
+	return redacted
+}
+
+// RedactJSON returns body with sensitive members masked. It returns an error if body is
+// not valid JSON.
+func RedactJSON(rd Redactor, body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	v = redactJSONValue(rd, nil, v)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func redactJSONValue(rd Redactor, path []string, v any) any {
+	if redacted, ok := rd.Field(path, v); ok {
+		return redacted
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for k, member := range v {
+			v[k] = redactJSONValue(rd, append(path[:len(path):len(path)], k), member)
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = redactJSONValue(rd, append(path[:len(path):len(path)], "*"), elem)
+		}
+	}
+	return v
+}
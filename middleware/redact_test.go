@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"bytes"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var cardNumber = regexp.MustCompile(`\b\d{4}(?:[ -]?\d{4}){3}\b`)
+
+func TestRedactHeaders(t *testing.T) {
+	rd := NewRedactor(RedactOptions{
+		NamePatterns:  []*regexp.Regexp{regexp.MustCompile(`(?i)-secret$`)},
+		ValuePatterns: []*regexp.Regexp{cardNumber},
+	})
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer abc")
+	h.Add("Cookie", "session=1")
+	h.Set("X-Client-Secret", "s3cr3t")
+	h.Set("X-Note", "card 4111 1111 1111 1111 on file")
+	h.Set("Accept", "application/json")
+
+	redacted := RedactHeaders(rd, h)
+
+	expected := map[string]string{
+		"Authorization":   DefaultRedactionMask,
+		"Cookie":          DefaultRedactionMask,
+		"X-Client-Secret": DefaultRedactionMask,
+		"X-Note":          "card [REDACTED] on file",
+		"Accept":          "application/json",
+	}
+	for name, want := range expected {
+		if got := redacted.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if h.Get("Authorization") != "Bearer abc" {
+		t.Error("RedactHeaders modified the original headers")
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	rd := NewRedactor(RedactOptions{QueryParams: []string{"Code"}})
+
+	got := RedactQuery(rd, "code=xyz&page=2&token=abc")
+	if got != "code=%5BREDACTED%5D&page=2&token=abc" {
+		t.Errorf("RedactQuery() = %q", got)
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	rd := NewRedactor(RedactOptions{
+		Fields:        []string{"password", "user.ssn", "cards.*.number"},
+		ValuePatterns: []*regexp.Regexp{cardNumber},
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "name at any depth",
+			body:     `{"password":"a","nested":{"Password":"b","keep":1}}`,
+			expected: `{"nested":{"Password":"[REDACTED]","keep":1},"password":"[REDACTED]"}`,
+		},
+		{
+			name:     "exact path",
+			body:     `{"user":{"ssn":"123-45-6789","name":"x"},"ssn":"kept"}`,
+			expected: `{"ssn":"kept","user":{"name":"x","ssn":"[REDACTED]"}}`,
+		},
+		{
+			name:     "wildcard path",
+			body:     `{"cards":[{"number":"1","exp":"12/30"},{"number":"2"}]}`,
+			expected: `{"cards":[{"exp":"12/30","number":"[REDACTED]"},{"number":"[REDACTED]"}]}`,
+		},
+		{
+			name:     "value pattern",
+			body:     `["paid with 4111-1111-1111-1111", 12345678901234567890]`,
+			expected: `["paid with [REDACTED]",12345678901234567890]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RedactJSON(rd, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("RedactJSON() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := RedactJSON(rd, []byte("not json")); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestRequestLoggerRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+
+	handler := RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetLogField(r.Context(), "refresh_token", "abc")
+		SetLogField(r.Context(), "user", "alice")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cb?access_token=abc&state=1", nil))
+
+	logStr := buf.String()
+	for _, expected := range []string{
+		`"query":"access_token=%5BREDACTED%5D&state=1"`,
+		`"refresh_token":"[REDACTED]"`,
+		`"user":"alice"`,
+	} {
+		if !strings.Contains(logStr, expected) {
+			t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+		}
+	}
+	if strings.Contains(logStr, "abc") {
+		t.Errorf("log leaks a secret\nLog: %s", logStr)
+	}
+}
@@ -16,6 +16,9 @@ func RequestID(next http.Handler) http.Handler {
 		w.Header().Set("X-Request-ID", reqID)
 
 		ctx := context.WithValue(r.Context(), requestIDKey, reqID)
+		if tc, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, traceContextKey, tc)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -1,12 +1,19 @@
 package middleware
 
 import (
-	"github.com/rs/zerolog/log"
+	"context"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
 	"net/http"
+	"sync"
 	"time"
 )
 
-// RequestLogger is a middleware that logs HTTP requests using zerolog
+var logger = logx.Named("request")
+
+// RequestLogger is a middleware that logs HTTP requests through logx. Requests served by a
+// chi router are logged with the matched route pattern, the prefix of the sub-router it
+// is mounted on and the handler name, so that /users/1 and /users/2 group together.
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -14,24 +21,123 @@ func RequestLogger(next http.Handler) http.Handler {
 		// Create a custom response writer to capture the status code
 		ww := &responseWriter{w: w, status: http.StatusOK}
 
-		next.ServeHTTP(ww, r)
-
-		// Log the request details
-		log.Info().
-			Str("request_id", GetRequestID(r.Context())).
-			Str("method", r.Method).
-			Str("path", r.URL.Path).
-			Str("remote_addr", r.RemoteAddr).
-			Int("status", ww.status).
-			Dur("latency", time.Since(start)).
-			Msg("request completed")
+		fields := &logFields{}
+		ctx := context.WithValue(r.Context(), logFieldsKey, fields)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		// Routing has completed, so the route context holds the full pattern
+		route, routed := GetRoute(ctx)
+
+		// Log the request details, masking anything sensitive
+		redactor := GetRedactor()
+		attrs := []slog.Attr{
+			slog.String("request_id", GetRequestID(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if r.URL.RawQuery != "" {
+			attrs = append(attrs, slog.String("query", RedactQuery(redactor, r.URL.RawQuery)))
+		}
+		if info, ok := GetClientInfo(r.Context()); ok {
+			attrs = append(attrs,
+				slog.String("client_ip", info.IP.String()),
+				slog.String("scheme", info.Scheme),
+				slog.String("host", info.Host))
+		}
+		if routed {
+			attrs = append(attrs, RouteAttrs(route)...)
+		}
+		attrs = append(attrs,
+			slog.Int("status", ww.status),
+			slog.Int64("bytes", ww.bytes),
+			slog.Duration("latency", time.Since(start)))
+		attrs = append(attrs, logx.MapAttrs(RedactFields(redactor, fields.snapshot()))...)
+		logger.Info(ctx, "request completed", attrs...)
 	})
 }
 
+// RouteAttrs returns route, mount and handler attributes for route, omitting those that
+// are empty
+func RouteAttrs(route Route) []slog.Attr {
+	attrs := []slog.Attr{slog.String("route", route.Pattern)}
+	if route.Mount != "" {
+		attrs = append(attrs, slog.String("mount", route.Mount))
+	}
+	if route.Handler != "" {
+		attrs = append(attrs, slog.String("handler", route.Handler))
+	}
+	return attrs
+}
+
+// SetLogField adds a field to the line RequestLogger writes for the request owning ctx.
+// It is a no-op when the request is not being logged.
+func SetLogField(ctx context.Context, key string, value any) {
+	if fields, ok := ctx.Value(logFieldsKey).(*logFields); ok {
+		fields.set(key, value)
+	}
+}
+
+// GetLogField returns a field set with SetLogField for the request owning ctx, so that
+// outer middleware can see what inner handlers recorded
+func GetLogField(ctx context.Context, key string) (any, bool) {
+	if fields, ok := ctx.Value(logFieldsKey).(*logFields); ok {
+		return fields.get(key)
+	}
+	return nil, false
+}
+
+// logFields collects extra fields contributed by downstream middleware and handlers
+type logFields struct {
+	mu      sync.Mutex
+	fields  map[string]any
+	handler string
+}
+
+func (f *logFields) set(key string, value any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fields == nil {
+		f.fields = make(map[string]any)
+	}
+	f.fields[key] = value
+}
+
+func (f *logFields) get(key string) (any, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.fields[key]
+	return value, ok
+}
+
+func (f *logFields) setHandlerName(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handler = name
+}
+
+func (f *logFields) handlerName() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.handler
+}
+
+func (f *logFields) snapshot() map[string]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	snapshot := make(map[string]any, len(f.fields))
+	for k, v := range f.fields {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
 // responseWriter is a custom response writer that captures the status code
 type responseWriter struct {
 	w           http.ResponseWriter
 	status      int
+	bytes       int64
 	wroteHeader bool
 }
 
@@ -43,7 +149,9 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	if !rw.wroteHeader {
 		rw.WriteHeader(http.StatusOK)
 	}
-	return rw.w.Write(b)
+	n, err := rw.w.Write(b)
+	rw.bytes += int64(n)
+	return n, err
 }
 
 func (rw *responseWriter) WriteHeader(statusCode int) {
@@ -55,3 +163,15 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
 	rw.w.WriteHeader(statusCode)
 	rw.wroteHeader = true
 }
+
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(rw.w).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"net/http"
@@ -107,6 +108,100 @@ func TestRequestLogger(t *testing.T) {
 	}
 }
 
+func getUser(w http.ResponseWriter, r *http.Request) {}
+
+func TestRequestLoggerRoute(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(RequestLogger)
+	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+	r.Route("/api", func(r chi.Router) {
+		r.Route("/v1", func(r chi.Router) {
+			r.Get("/users/{id}", getUser)
+			r.With(func(next http.Handler) http.Handler { return next }).Get("/named", func(w http.ResponseWriter, r *http.Request) {
+				SetHandlerName(r.Context(), "custom.Handler")
+			})
+		})
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedLogs []string
+		absentLogs   []string
+	}{
+		{
+			name:         "root route",
+			path:         "/health",
+			expectedLogs: []string{`"route":"/health"`, `"handler":"middleware.TestRequestLoggerRoute.func1"`},
+			absentLogs:   []string{`"mount"`},
+		},
+		{
+			name: "mounted route",
+			path: "/api/v1/users/123",
+			expectedLogs: []string{
+				`"path":"/api/v1/users/123"`,
+				`"route":"/api/v1/users/{id}"`,
+				`"mount":"/api/v1"`,
+				`"handler":"middleware.getUser"`,
+			},
+		},
+		{
+			name:         "explicit handler name",
+			path:         "/api/v1/named",
+			expectedLogs: []string{`"route":"/api/v1/named"`, `"handler":"custom.Handler"`},
+		},
+		{
+			name:       "no matching route",
+			path:       "/missing",
+			absentLogs: []string{`"route"`, `"handler"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.Logger = zerolog.New(&buf)
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			logStr := buf.String()
+			for _, expectedLog := range tt.expectedLogs {
+				if !strings.Contains(logStr, expectedLog) {
+					t.Errorf("log doesn't contain %q\nLog: %s", expectedLog, logStr)
+				}
+			}
+			for _, absentLog := range tt.absentLogs {
+				if strings.Contains(logStr, absentLog) {
+					t.Errorf("log contains %q\nLog: %s", absentLog, logStr)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupHandlerName(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/users/{id}", getUser)
+
+	if name := lookupHandlerName(r, http.MethodGet, "/users/{id}"); name != "middleware.getUser" {
+		t.Errorf("lookupHandlerName() = %q, want middleware.getUser", name)
+	}
+	if name := lookupHandlerName(r, http.MethodGet, "/missing"); name != "" {
+		t.Errorf("lookupHandlerName() for a missing route = %q", name)
+	}
+
+	// Routes added after serving starts are found, and earlier results are kept
+	r.Post("/users", getUser)
+	if name := lookupHandlerName(r, http.MethodPost, "/users"); name != "middleware.getUser" {
+		t.Errorf("lookupHandlerName() for a late route = %q, want middleware.getUser", name)
+	}
+	cached, _ := handlerNames.Load(chi.Routes(r))
+	rn := cached.(*routeNames)
+	if name, ok := rn.names["GET /missing"]; !ok || name != "" {
+		t.Error("a later walk dropped the remembered miss")
+	}
+}
+
 func TestResponseWriter(t *testing.T) {
 	tests := []struct {
 		name         string
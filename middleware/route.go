@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Route describes the chi route that matched a request
+type Route struct {
+	// Pattern is the full route pattern, such as /api/users/{id}
+	Pattern string
+	// Mount is the prefix of the sub-router serving the route, such as /api. It is empty
+	// for routes on the root router.
+	Mount string
+	// Handler names the function handling the route
+	Handler string
+}
+
+// GetRoute returns the route matched for the request owning ctx. It reports false before
+// routing has completed and when no route matched.
+func GetRoute(ctx context.Context) (Route, bool) {
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil || len(rctx.RoutePatterns) == 0 {
+		return Route{}, false
+	}
+
+	route := Route{Pattern: rctx.RoutePattern()}
+	if n := len(rctx.RoutePatterns); n > 1 {
+		mount := strings.ReplaceAll(strings.Join(rctx.RoutePatterns[:n-1], ""), "/*/", "/")
+		route.Mount = strings.TrimSuffix(mount, "/*")
+	}
+
+	if fields, ok := ctx.Value(logFieldsKey).(*logFields); ok {
+		route.Handler = fields.handlerName()
+	}
+	if route.Handler == "" && rctx.Routes != nil {
+		route.Handler = lookupHandlerName(rctx.Routes, rctx.RouteMethod, route.Pattern)
+	}
+	return route, true
+}
+
+// CopyRouteContext returns ctx with its own copy of chi's route context, for serving the
+// request on another goroutine. chi pools route contexts and resets them once the request
+// that owns them returns, which that goroutine would otherwise race with.
+func CopyRouteContext(ctx context.Context) context.Context {
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil {
+		return ctx
+	}
+	dup := chi.NewRouteContext()
+	copyRouteContext(dup, rctx)
+	return context.WithValue(ctx, chi.RouteCtxKey, dup)
+}
+
+// MergeRouteContext copies the routing done on from, a context returned by
+// CopyRouteContext, back to the route context of to, so that GetRoute reports the matched
+// route. Call it only once the goroutine serving from has finished.
+func MergeRouteContext(to, from context.Context) {
+	dst, src := chi.RouteContext(to), chi.RouteContext(from)
+	if dst == nil || src == nil || dst == src {
+		return
+	}
+	copyRouteContext(dst, src)
+}
+
+func copyRouteContext(dst, src *chi.Context) {
+	dst.Routes = src.Routes
+	dst.RoutePath = src.RoutePath
+	dst.RouteMethod = src.RouteMethod
+	dst.RoutePatterns = slices.Clone(src.RoutePatterns)
+	dst.URLParams.Keys = slices.Clone(src.URLParams.Keys)
+	dst.URLParams.Values = slices.Clone(src.URLParams.Values)
+}
+
+// SetHandlerName records the name of the handler serving the request owning ctx, for
+// wrappers such as errorx.ErrorHandler that would otherwise hide the function they call
+func SetHandlerName(ctx context.Context, name string) {
+	if fields, ok := ctx.Value(logFieldsKey).(*logFields); ok {
+		fields.setHandlerName(name)
+	}
+}
+
+// HandlerName returns a readable name for a handler function or value, such as
+// "users.(*Service).Get" or "*httputil.ReverseProxy"
+func HandlerName(h any) string {
+	v := reflect.ValueOf(h)
+	if v.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", h)
+	}
+	fn := runtime.FuncForPC(v.Pointer())
+	if fn == nil {
+		return fmt.Sprintf("%T", h)
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// handlerNames caches the handler name of every route, per root router
+var handlerNames sync.Map // chi.Routes -> *routeNames
+
+type routeNames struct {
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+// lookupHandlerName finds the endpoint registered for method and pattern. The route tree
+// is walked once per router and again only for a pattern that is not known yet, which
+// happens when routes are added after serving starts. Names found by later walks are added
+// to those already known.
+func lookupHandlerName(routes chi.Routes, method, pattern string) string {
+	cached, _ := handlerNames.LoadOrStore(routes, &routeNames{})
+	rn := cached.(*routeNames)
+	key := method + " " + pattern
+
+	rn.mu.RLock()
+	name, ok := rn.names[key]
+	rn.mu.RUnlock()
+	if ok {
+		return name
+	}
+
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	if name, ok := rn.names[key]; ok {
+		return name
+	}
+	if rn.names == nil {
+		rn.names = make(map[string]string)
+	}
+	chi.Walk(routes, func(method, route string, handler http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		rn.names[method+" "+route] = HandlerName(handler)
+		return nil
+	})
+	if _, ok := rn.names[key]; !ok {
+		// Remember misses, such as 404s inside a mounted router, to avoid walking again
+		rn.names[key] = ""
+	}
+	return rn.names[key]
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     SecurityHeadersOptions
+		expected map[string]string
+	}{
+		{
+			name: "defaults",
+			opts: SecurityHeadersOptions{},
+			expected: map[string]string{
+				"Strict-Transport-Security":    "max-age=63072000",
+				"X-Content-Type-Options":       "nosniff",
+				"X-Frame-Options":              "DENY",
+				"Referrer-Policy":              "strict-origin-when-cross-origin",
+				"Permissions-Policy":           "camera=(), microphone=(), geolocation=(), payment=()",
+				"Cross-Origin-Opener-Policy":   "same-origin",
+				"Cross-Origin-Resource-Policy": "same-origin",
+				"Cross-Origin-Embedder-Policy": "",
+				"Content-Security-Policy":      "default-src 'self'; base-uri 'self'; object-src 'none'; frame-ancestors 'none'; form-action 'self'",
+			},
+		},
+		{
+			name: "overrides and omissions",
+			opts: SecurityHeadersOptions{
+				HSTSMaxAge:                time.Hour,
+				HSTSIncludeSubdomains:     true,
+				HSTSPreload:               true,
+				FrameOptions:              "SAMEORIGIN",
+				ReferrerPolicy:            OmitHeader,
+				CrossOriginEmbedderPolicy: "require-corp",
+				CSP:                       NewCSP().Directive("default-src", "'none'"),
+				CSPReportOnly:             true,
+			},
+			expected: map[string]string{
+				"Strict-Transport-Security":           "max-age=3600; includeSubDomains; preload",
+				"X-Frame-Options":                     "SAMEORIGIN",
+				"Referrer-Policy":                     "",
+				"Cross-Origin-Embedder-Policy":        "require-corp",
+				"Content-Security-Policy":             "",
+				"Content-Security-Policy-Report-Only": "default-src 'none'",
+			},
+		},
+		{
+			name: "hsts disabled",
+			opts: SecurityHeadersOptions{HSTSMaxAge: -1},
+			expected: map[string]string{
+				"Strict-Transport-Security": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SecurityHeaders(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			for name, want := range tt.expected {
+				if got := rr.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersNonce(t *testing.T) {
+	csp := DefaultCSP().
+		Directive("script-src", "'self'", NonceSource).
+		Directive("default-src", "'none'")
+
+	var nonces []string
+	handler := SecurityHeaders(SecurityHeadersOptions{CSP: csp})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonces = append(nonces, CSPNonce(r.Context()))
+		}))
+
+	var headers []string
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		headers = append(headers, rr.Header().Get("Content-Security-Policy"))
+	}
+
+	if nonces[0] == "" || nonces[0] == nonces[1] {
+		t.Fatalf("expected distinct per-request nonces, got %q", nonces)
+	}
+	for i, header := range headers {
+		if !strings.Contains(header, "script-src 'self' 'nonce-"+nonces[i]+"'") {
+			t.Errorf("CSP %q does not contain nonce %q", header, nonces[i])
+		}
+		if !strings.HasPrefix(header, "default-src 'none'; ") {
+			t.Errorf("CSP %q did not replace default-src in place", header)
+		}
+	}
+}
+
+func TestCSPNonceWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got := CSPNonce(req.Context()); got != "" {
+		t.Errorf("CSPNonce() = %q, want empty", got)
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogOptions configures the handler returned by NewSlogHandler
+type SlogOptions struct {
+	// TraceIDs returns the trace and span IDs for ctx, for example from an OpenTelemetry
+	// span. Defaults to the traceparent header read by RequestID.
+	TraceIDs func(ctx context.Context) (traceID, spanID string)
+}
+
+// NewSlogHandler wraps h so that records logged with a request's context carry its
+// request_id, trace_id and span_id. Like other record attributes, they are nested in any
+// group opened with WithGroup.
+func NewSlogHandler(h slog.Handler, opts SlogOptions) slog.Handler {
+	if opts.TraceIDs == nil {
+		opts.TraceIDs = traceparentIDs
+	}
+	return &contextHandler{Handler: h, traceIDs: opts.TraceIDs}
+}
+
+func traceparentIDs(ctx context.Context) (string, string) {
+	tc, _ := GetTraceContext(ctx)
+	return tc.TraceID, tc.SpanID
+}
+
+type contextHandler struct {
+	slog.Handler
+	traceIDs func(ctx context.Context) (string, string)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx == nil {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	var attrs []slog.Attr
+	if id := GetRequestID(ctx); id != "" && !hasAttr(r, "request_id") {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if traceID, spanID := h.traceIDs(ctx); traceID != "" && !hasAttr(r, "trace_id") {
+		attrs = append(attrs, slog.String("trace_id", traceID))
+		if spanID != "" {
+			attrs = append(attrs, slog.String("span_id", spanID))
+		}
+	}
+	if len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func hasAttr(r slog.Record, key string) bool {
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		found = a.Key == key
+		return !found
+	})
+	return found
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs), traceIDs: h.traceIDs}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name), traceIDs: h.traceIDs}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected TraceContext
+		ok       bool
+	}{
+		{
+			header:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expected: TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true},
+			ok:       true,
+		},
+		{
+			header:   "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra",
+			expected: TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"},
+			ok:       true,
+		},
+		{header: ""},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := parseTraceparent(tt.header)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("parseTraceparent() = %+v, %v; want %+v, %v", got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         SlogOptions
+		traceparent  string
+		attrs        []any
+		expectedLogs []string
+		unwantedLogs []string
+	}{
+		{
+			name:         "request ID",
+			expectedLogs: []string{`"request_id":"req-1"`},
+			unwantedLogs: []string{"trace_id"},
+		},
+		{
+			name:         "trace context",
+			traceparent:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expectedLogs: []string{`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`, `"span_id":"00f067aa0ba902b7"`},
+		},
+		{
+			name: "custom trace IDs",
+			opts: SlogOptions{TraceIDs: func(ctx context.Context) (string, string) {
+				return "otel-trace", ""
+			}},
+			expectedLogs: []string{`"trace_id":"otel-trace"`},
+			unwantedLogs: []string{"span_id"},
+		},
+		{
+			name:         "explicit attributes win",
+			attrs:        []any{"request_id", "explicit"},
+			expectedLogs: []string{`"request_id":"explicit"`},
+			unwantedLogs: []string{"req-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := slog.New(NewSlogHandler(slog.NewJSONHandler(&buf, nil), tt.opts))
+
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logger.InfoContext(r.Context(), "handled", tt.attrs...)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Request-ID", "req-1")
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			logStr := buf.String()
+			for _, expected := range tt.expectedLogs {
+				if !strings.Contains(logStr, expected) {
+					t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+				}
+			}
+			for _, unwanted := range tt.unwantedLogs {
+				if strings.Contains(logStr, unwanted) {
+					t.Errorf("log contains %q\nLog: %s", unwanted, logStr)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLoggerSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logx.SetLogger(logx.Slog(NewSlogHandler(slog.NewJSONHandler(&buf, nil), SlogOptions{})))
+	defer logx.SetLogger(nil)
+
+	handler := RequestID(RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetLogField(r.Context(), "user", "alice")
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	logStr := buf.String()
+	for _, expected := range []string{
+		`"msg":"request completed"`,
+		`"status":202`,
+		`"user":"alice"`,
+		`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+	} {
+		if !strings.Contains(logStr, expected) {
+			t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+		}
+	}
+	if strings.Count(logStr, `"request_id"`) != 1 {
+		t.Errorf("expected a single request_id\nLog: %s", logStr)
+	}
+}
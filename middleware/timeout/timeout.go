@@ -0,0 +1,226 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDeadlineHeader carries the time an upstream caller is still willing to wait, either
+// as a Go duration such as "1.5s" or as a whole number of milliseconds
+const DefaultDeadlineHeader = "X-Request-Timeout"
+
+// ErrTimeout is the error reported when a handler overruns its deadline
+var ErrTimeout = errors.New("request timed out")
+
+var logger = logx.Named("timeout")
+
+// Options configures the timeout middleware
+type Options struct {
+	// Timeout is the longest a handler may run
+	Timeout time.Duration
+	// Status is the status sent when a handler overruns without writing a response.
+	// Defaults to 503; 504 suits services that mostly wait on upstream calls.
+	Status int
+	// DeadlineHeader names the inbound header used to shorten the timeout to the caller's
+	// remaining budget. Defaults to DefaultDeadlineHeader; "-" disables it.
+	DeadlineHeader string
+}
+
+// New returns a middleware that bounds how long handlers may run. The request context
+// carries the deadline, so well-behaved handlers stop work on their own. A handler that
+// overruns without writing receives a JSON error with Status in its place; one that has
+// already started writing has its response cut short. Either way, further writes fail with
+// http.ErrHandlerTimeout and the request is logged with timed_out=true. A handler that panics
+// after its deadline has passed is logged, since nothing is left to recover it. The
+// middleware may be nested, in which case the shortest deadline wins. New panics if Timeout
+// is not positive.
+func New(opts Options) func(http.Handler) http.Handler {
+	if opts.Timeout <= 0 {
+		panic("timeout: Timeout must be positive")
+	}
+	if opts.Status == 0 {
+		opts.Status = http.StatusServiceUnavailable
+	}
+	if opts.DeadlineHeader == "" {
+		opts.DeadlineHeader = DefaultDeadlineHeader
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := opts.Timeout
+			if opts.DeadlineHeader != "-" {
+				if budget, ok := parseBudget(r.Header.Get(opts.DeadlineHeader)); ok && budget < limit {
+					limit = budget
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), limit)
+			defer cancel()
+
+			// The handler routes on its own copy of chi's route context, which chi would
+			// otherwise reset under an abandoned handler once this middleware returns
+			handlerCtx := middleware.CopyRouteContext(ctx)
+
+			tw := &timeoutWriter{w: w, header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						tw.mu.Lock()
+						defer tw.mu.Unlock()
+						if !tw.abandoned {
+							panicked <- p
+							return
+						}
+						logger.Error(r.Context(), "handler panicked after timing out",
+							slog.String("request_id", middleware.GetRequestID(r.Context())),
+							slog.Any("panic", p),
+							slog.String("stack", string(debug.Stack())))
+						return
+					}
+					close(done)
+				}()
+				next.ServeHTTP(tw, r.WithContext(handlerCtx))
+			}()
+
+			finished := false
+			select {
+			case p := <-panicked:
+				// Re-raise on the serving goroutine so that Recoverer can handle it
+				panic(p)
+			case <-done:
+				finished = true
+				middleware.MergeRouteContext(r.Context(), handlerCtx)
+			case <-ctx.Done():
+			}
+
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+			if finished && !tw.wroteHeader && !timedOut {
+				// The handler returned without writing, so send its headers with the implicit
+				// 200 that net/http would
+				tw.writeHeaderLocked(http.StatusOK)
+			}
+			tw.abandoned = true
+			select {
+			case p := <-panicked:
+				// The handler panicked while the deadline passed
+				panic(p)
+			default:
+			}
+
+			// A handler that gave up on its deadline without responding still gets a timeout
+			// error; a cancelled context means the client went away and nobody is listening
+			if !timedOut || (finished && tw.wroteHeader) {
+				return
+			}
+
+			middleware.SetLogField(r.Context(), "timed_out", true)
+			middleware.SetLogField(r.Context(), "timeout", limit.String())
+			if !tw.wroteHeader {
+				errorx.RespondError(w, errorx.NewApiError(ErrTimeout, opts.Status))
+			}
+		})
+	}
+}
+
+// Remaining returns the time left before the deadline of ctx
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
+
+// Propagate sets DefaultDeadlineHeader on an outbound request to the time remaining before
+// the deadline of ctx, so the downstream service can stop work the caller no longer awaits
+func Propagate(ctx context.Context, outbound *http.Request) {
+	if remaining, ok := Remaining(ctx); ok {
+		outbound.Header.Set(DefaultDeadlineHeader, strconv.FormatInt(max(remaining.Milliseconds(), 0), 10))
+	}
+}
+
+func parseBudget(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(max(ms, 0)) * time.Millisecond, true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(d, 0), true
+}
+
+// timeoutWriter guards the response so that the handler goroutine cannot write once the
+// middleware has responded or returned. The handler gets its own header map, copied to the
+// real response when it writes the status.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	abandoned   bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(statusCode)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(statusCode int) {
+	if tw.abandoned || tw.wroteHeader {
+		return
+	}
+	dst := tw.w.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(statusCode)
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.abandoned {
+		return
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	http.NewResponseController(tw.w).Flush()
+}
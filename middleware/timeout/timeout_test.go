@@ -0,0 +1,325 @@
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           Options
+		header         string
+		handler        func(w http.ResponseWriter, r *http.Request)
+		expectedCode   int
+		expectedBody   string
+		expectTimedOut bool
+	}{
+		{
+			name: "fast handler",
+			opts: Options{Timeout: time.Second},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Handler", "yes")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("done"))
+			},
+			expectedCode: http.StatusCreated,
+			expectedBody: "done",
+		},
+		{
+			name: "slow handler",
+			opts: Options{Timeout: 20 * time.Millisecond},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+				time.Sleep(10 * time.Millisecond)
+				w.Write([]byte("too late"))
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectTimedOut: true,
+		},
+		{
+			name: "gateway timeout status",
+			opts: Options{Timeout: 20 * time.Millisecond, Status: http.StatusGatewayTimeout},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			expectedCode:   http.StatusGatewayTimeout,
+			expectTimedOut: true,
+		},
+		{
+			name: "handler ignoring the deadline",
+			opts: Options{Timeout: 20 * time.Millisecond},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(100 * time.Millisecond)
+				w.Write([]byte("too late"))
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectTimedOut: true,
+		},
+		{
+			name: "handler already writing",
+			opts: Options{Timeout: 20 * time.Millisecond},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("partial"))
+				<-r.Context().Done()
+				time.Sleep(10 * time.Millisecond)
+				if _, err := w.Write([]byte(" more")); !errors.Is(err, http.ErrHandlerTimeout) {
+					t.Errorf("write after timeout error = %v, want http.ErrHandlerTimeout", err)
+				}
+			},
+			expectedCode:   http.StatusOK,
+			expectedBody:   "partial",
+			expectTimedOut: true,
+		},
+		{
+			name:   "inbound deadline shortens timeout",
+			opts:   Options{Timeout: time.Minute},
+			header: "20",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectTimedOut: true,
+		},
+		{
+			name:   "inbound deadline cannot extend timeout",
+			opts:   Options{Timeout: 20 * time.Millisecond},
+			header: "1h",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectTimedOut: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := New(tt.opts)(http.HandlerFunc(tt.handler))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(DefaultDeadlineHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			start := time.Now()
+			handler.ServeHTTP(rr, req)
+			if elapsed := time.Since(start); elapsed > 80*time.Millisecond && tt.expectTimedOut {
+				t.Errorf("middleware returned after %s, expected it to return at the deadline", elapsed)
+			}
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.expectedBody)
+			}
+			if tt.expectTimedOut && tt.expectedBody == "" {
+				var body struct {
+					Error string `json:"error"`
+					Code  int    `json:"code"`
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+					t.Errorf("expected JSON error body, got %q", rr.Body.String())
+				}
+				if body.Error != ErrTimeout.Error() || body.Code != tt.expectedCode {
+					t.Errorf("body = %+v, want the timeout message and code %d", body, tt.expectedCode)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeoutHeadersAreIsolated(t *testing.T) {
+	handler := New(Options{Timeout: 20 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Header().Set("X-Handler", "late")
+	}))
+
+	rr := httptest.NewRecorder()
+	rr.Header().Set("X-Outer", "kept")
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Header().Get("X-Outer") != "kept" {
+		t.Error("headers set before the middleware were lost")
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestTimeoutSendsHeadersWithoutBody(t *testing.T) {
+	handler := New(Options{Timeout: time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/orders/1")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if rr.Header().Get("Location") != "/orders/1" {
+		t.Errorf("Location = %q, want the handler's header", rr.Header().Get("Location"))
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for the handler goroutine and the test to share
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTimeoutLogsLatePanic(t *testing.T) {
+	var buf lockedBuffer
+	log.Logger = zerolog.New(&buf)
+
+	handler := New(Options{Timeout: 10 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		panic("late boom")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), "late boom") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if logStr := buf.String(); !strings.Contains(logStr, "handler panicked after timing out") {
+		t.Errorf("log doesn't report the late panic\nLog: %s", logStr)
+	}
+}
+
+func TestTimeoutRepanics(t *testing.T) {
+	handler := New(Options{Timeout: time.Second})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Errorf("recovered %v, want boom", p)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestTimeoutBehindRouter(t *testing.T) {
+	var pattern string
+	late := make(chan string, 1)
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			route, _ := middleware.GetRoute(r.Context())
+			pattern = route.Pattern
+		})
+	})
+	r.Use(New(Options{Timeout: 20 * time.Millisecond}))
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(chi.URLParam(r, "id")))
+	})
+	r.Get("/slow/{id}", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(20 * time.Millisecond)
+		late <- chi.URLParam(r, "id")
+	})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	if rr.Body.String() != "42" || pattern != "/users/{id}" {
+		t.Errorf("body = %q, route = %q, want 42 on /users/{id}", rr.Body.String(), pattern)
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow/7", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	// Serving another request makes chi reuse the abandoned handler's route context if it
+	// were shared
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if id := <-late; id != "7" {
+		t.Errorf("abandoned handler saw id %q, want 7", id)
+	}
+}
+
+func TestPropagate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	out, _ := http.NewRequest(http.MethodGet, "http://upstream.test", nil)
+	Propagate(ctx, out)
+
+	ms, err := strconv.Atoi(out.Header.Get(DefaultDeadlineHeader))
+	if err != nil || ms <= 0 || ms > 2000 {
+		t.Errorf("%s = %q, want remaining milliseconds", DefaultDeadlineHeader, out.Header.Get(DefaultDeadlineHeader))
+	}
+
+	out, _ = http.NewRequest(http.MethodGet, "http://upstream.test", nil)
+	Propagate(context.Background(), out)
+	if got := out.Header.Get(DefaultDeadlineHeader); got != "" {
+		t.Errorf("%s = %q without a deadline, want empty", DefaultDeadlineHeader, got)
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "250", expected: 250 * time.Millisecond, ok: true},
+		{value: "1.5s", expected: 1500 * time.Millisecond, ok: true},
+		{value: "-5", expected: 0, ok: true},
+		{value: "", ok: false},
+		{value: "soon", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseBudget(tt.value)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("parseBudget(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestNewRejectsNonPositiveTimeout(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for zero timeout")
+		}
+	}()
+	New(Options{})
+}
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// PrivateNetworks lists the loopback and private address ranges, for deployments where
+// every proxy runs inside the local network
+var PrivateNetworks = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+// ProxyOptions configures the TrustedProxies middleware
+type ProxyOptions struct {
+	// TrustedCIDRs lists the networks whose forwarding headers are honored. With none
+	// configured, forwarding headers are ignored and the peer address is the client.
+	TrustedCIDRs []string
+}
+
+// ClientInfo describes the client as seen by the first trusted proxy
+type ClientInfo struct {
+	IP     netip.Addr
+	Scheme string
+	Host   string
+}
+
+// forwardedHop is one proxy hop, as described by a Forwarded element or X-Forwarded-* entry
+type forwardedHop struct {
+	addr  netip.Addr
+	valid bool
+	proto string
+	host  string
+}
+
+// TrustedProxies returns a middleware that resolves the client's address, scheme and host.
+// Forwarding headers are only honored when the immediate peer is in a trusted network,
+// preferring RFC 7239 Forwarded over X-Forwarded-For, X-Forwarded-Proto and
+// X-Forwarded-Host, then X-Real-IP. The forwarding chain is walked right to left, skipping
+// trusted proxies, and the first untrusted address is taken as the client, so entries a
+// client prepends itself are never believed. The result is stored in the request context
+// and logged by RequestLogger. TrustedProxies panics on an invalid CIDR.
+func TrustedProxies(opts ProxyOptions) func(http.Handler) http.Handler {
+	trusted := make([]netip.Prefix, 0, len(opts.TrustedCIDRs))
+	for _, cidr := range opts.TrustedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			panic("middleware: invalid trusted proxy CIDR " + cidr + ": " + err.Error())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := ClientInfo{Scheme: "http", Host: r.Host}
+			if r.TLS != nil {
+				info.Scheme = "https"
+			}
+			peer, _ := parseNodeAddr(r.RemoteAddr)
+			info.IP = peer
+
+			if peer.IsValid() && isTrusted(peer) {
+				resolveForwarded(r, &info, isTrusted)
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientInfoKey, info)))
+		})
+	}
+}
+
+// resolveForwarded updates info from the forwarding headers of a request received from a
+// trusted proxy
+func resolveForwarded(r *http.Request, info *ClientInfo, isTrusted func(netip.Addr) bool) {
+	hops := forwardedHops(r)
+	if len(hops) == 0 {
+		if addr, ok := parseNodeAddr(r.Header.Get("X-Real-IP")); ok {
+			info.IP = addr
+		}
+		return
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := hops[i]
+		if !hop.valid {
+			// The chain cannot be followed past an obfuscated or malformed entry, so the
+			// proxy that recorded it is the best known client
+			return
+		}
+
+		info.IP = hop.addr
+		if hop.proto != "" {
+			info.Scheme = strings.ToLower(hop.proto)
+		}
+		if hop.host != "" {
+			info.Host = hop.host
+		}
+		if !isTrusted(hop.addr) {
+			return
+		}
+	}
+}
+
+// forwardedHops parses the Forwarded header, falling back to X-Forwarded-For
+func forwardedHops(r *http.Request) []forwardedHop {
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		var hops []forwardedHop
+		for _, element := range parseHeaderList(values) {
+			hop := forwardedHop{}
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				value = strings.Trim(value, `"`)
+				switch strings.ToLower(key) {
+				case "for":
+					hop.addr, hop.valid = parseNodeAddr(value)
+				case "proto":
+					hop.proto = value
+				case "host":
+					hop.host = value
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+
+	addrs := parseHeaderList(r.Header.Values("X-Forwarded-For"))
+	if len(addrs) == 0 {
+		return nil
+	}
+	hops := make([]forwardedHop, len(addrs))
+	for i, addr := range addrs {
+		hops[i].addr, hops[i].valid = parseNodeAddr(addr)
+	}
+	// X-Forwarded-Proto and X-Forwarded-Host are set, not appended, by most proxies, so
+	// the value recorded by the nearest proxy applies to the whole chain
+	if protos := parseHeaderList(r.Header.Values("X-Forwarded-Proto")); len(protos) > 0 {
+		hops[len(hops)-1].proto = protos[len(protos)-1]
+	}
+	if hosts := parseHeaderList(r.Header.Values("X-Forwarded-Host")); len(hosts) > 0 {
+		hops[len(hops)-1].host = hosts[len(hosts)-1]
+	}
+	return hops
+}
+
+// parseNodeAddr parses an IP address optionally carrying a port, in either host:port or
+// [ipv6]:port form
+func parseNodeAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// GetClientInfo returns the client details resolved by TrustedProxies
+func GetClientInfo(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(clientInfoKey).(ClientInfo)
+	return info, ok
+}
+
+// ClientIP returns the client address resolved by TrustedProxies, falling back to the
+// address of the immediate peer
+func ClientIP(r *http.Request) string {
+	if info, ok := GetClientInfo(r.Context()); ok && info.IP.IsValid() {
+		return info.IP.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	opts := ProxyOptions{TrustedCIDRs: []string{"10.0.0.0/8", "2001:db8:ffff::/48"}}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		tls            bool
+		headers        map[string][]string
+		expectedIP     string
+		expectedScheme string
+		expectedHost   string
+	}{
+		{
+			name:           "direct client",
+			remoteAddr:     "203.0.113.7:5000",
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:           "direct tls client",
+			remoteAddr:     "203.0.113.7:5000",
+			tls:            true,
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "https",
+			expectedHost:   "example.com",
+		},
+		{
+			name:       "untrusted peer cannot spoof headers",
+			remoteAddr: "203.0.113.7:5000",
+			headers: map[string][]string{
+				"X-Forwarded-For":   {"1.2.3.4"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Real-IP":         {"1.2.3.4"},
+				"Forwarded":         {"for=1.2.3.4;proto=https"},
+			},
+			expectedIP:     "203.0.113.7",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:       "x-forwarded-for through trusted proxy",
+			remoteAddr: "10.0.0.2:443",
+			headers: map[string][]string{
+				"X-Forwarded-For":   {"198.51.100.9"},
+				"X-Forwarded-Proto": {"https"},
+				"X-Forwarded-Host":  {"api.example.com"},
+			},
+			expectedIP:     "198.51.100.9",
+			expectedScheme: "https",
+			expectedHost:   "api.example.com",
+		},
+		{
+			name:       "spoofed entries left of the client are ignored",
+			remoteAddr: "10.0.0.2:443",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"6.6.6.6, 198.51.100.9, 10.0.0.5"},
+			},
+			expectedIP:     "198.51.100.9",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:       "multiple header lines",
+			remoteAddr: "10.0.0.2:443",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"6.6.6.6", "198.51.100.9"},
+			},
+			expectedIP:     "198.51.100.9",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:       "all hops trusted",
+			remoteAddr: "10.0.0.2:443",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"10.1.1.1, 10.0.0.5"},
+			},
+			expectedIP:     "10.1.1.1",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:       "forwarded takes precedence",
+			remoteAddr: "10.0.0.2:443",
+			headers: map[string][]string{
+				"Forwarded":       {`for="[2001:db8::17]:4711";proto=https;host=shop.example.com, for=10.0.0.5;proto=http`},
+				"X-Forwarded-For": {"6.6.6.6"},
+			},
+			expectedIP:     "2001:db8::17",
+			expectedScheme: "https",
+			expectedHost:   "shop.example.com",
+		},
+		{
+			name:       "obfuscated forwarded entry stops the walk",
+			remoteAddr: "10.0.0.2:443",
+			headers: map[string][]string{
+				"Forwarded": {"for=_hidden, for=10.0.0.5"},
+			},
+			expectedIP:     "10.0.0.5",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:       "x-real-ip from trusted proxy",
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			headers: map[string][]string{
+				"X-Real-IP": {"198.51.100.9"},
+			},
+			expectedIP:     "198.51.100.9",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+		{
+			name:       "ipv4-mapped peer",
+			remoteAddr: "[::ffff:10.0.0.2]:443",
+			headers: map[string][]string{
+				"X-Forwarded-For": {"198.51.100.9:1234"},
+			},
+			expectedIP:     "198.51.100.9",
+			expectedScheme: "http",
+			expectedHost:   "example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info ClientInfo
+			var clientIP string
+			handler := TrustedProxies(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				info, _ = GetClientInfo(r.Context())
+				clientIP = ClientIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, values := range tt.headers {
+				for _, v := range values {
+					req.Header.Add(k, v)
+				}
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if info.IP.String() != tt.expectedIP || clientIP != tt.expectedIP {
+				t.Errorf("client IP = %s (ClientIP %s), want %s", info.IP, clientIP, tt.expectedIP)
+			}
+			if info.Scheme != tt.expectedScheme {
+				t.Errorf("scheme = %q, want %q", info.Scheme, tt.expectedScheme)
+			}
+			if info.Host != tt.expectedHost {
+				t.Errorf("host = %q, want %q", info.Host, tt.expectedHost)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesRejectsInvalidCIDR(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for invalid CIDR")
+		}
+	}()
+	TrustedProxies(ProxyOptions{TrustedCIDRs: []string{"not-a-cidr"}})
+}
+
+func TestClientIPWithoutMiddleware(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if got := ClientIP(req); got != "192.0.2.1" {
+		t.Errorf("ClientIP() = %q, want 192.0.2.1", got)
+	}
+}
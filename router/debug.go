@@ -0,0 +1,331 @@
+package router
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	enhancedmiddleware "github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/httpx"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDebugPrefix is where the debug routes are served unless DebugOptions.Prefix is set
+const DefaultDebugPrefix = "/debug"
+
+// maxDescribeDepth bounds how deeply /config follows nested values, which also stops cycles
+const maxDescribeDepth = 8
+
+var (
+	logger  = logx.Named("router")
+	started = time.Now()
+)
+
+// DebugOptions configures the debug routes added by WithDebug
+type DebugOptions struct {
+	// Prefix is the path the debug routes are served under. Defaults to DefaultDebugPrefix.
+	Prefix string
+	// Middlewares guard the debug routes, for example auth.New and auth.Require. They are
+	// required unless Listener is set.
+	Middlewares []func(http.Handler) http.Handler
+	// Listener serves the debug routes on their own server, such as one bound to a loopback
+	// address, instead of mounting them on the router
+	Listener net.Listener
+	// Server serves Listener, with its Handler replaced by the debug routes. Keep it to stop
+	// the debug server gracefully with Shutdown. Without it a default server is used, which
+	// stops only when Listener is closed and leaves running profiles to finish on their own.
+	Server *http.Server
+	// Config is application configuration to show at /config alongside the router's. Fields
+	// named by the redactor set with middleware.SetRedactor are masked, and its value
+	// patterns apply to every string, including named string types. Byte slices are shown
+	// by length only. Secrets held under other names or in other types are shown as they
+	// are, so keep them out of Config.
+	Config any
+}
+
+// setting is an option passed to New, as shown at /config
+type setting struct {
+	Option string `json:"option"`
+	Config any    `json:"config,omitempty"`
+}
+
+// routeInfo describes a route registered on the router
+type routeInfo struct {
+	Method      string `json:"method"`
+	Pattern     string `json:"pattern"`
+	Handler     string `json:"handler"`
+	Middlewares int    `json:"middlewares,omitempty"`
+}
+
+// runtimeInfo is the body of /runtime
+type runtimeInfo struct {
+	GoVersion    string           `json:"go_version"`
+	GOOS         string           `json:"goos"`
+	GOARCH       string           `json:"goarch"`
+	NumCPU       int              `json:"num_cpu"`
+	GOMAXPROCS   int              `json:"gomaxprocs"`
+	NumGoroutine int              `json:"num_goroutine"`
+	NumCgoCall   int64            `json:"num_cgo_call"`
+	Uptime       string           `json:"uptime"`
+	MemStats     runtime.MemStats `json:"memstats"`
+}
+
+// WithDebug serves pprof profiles, goroutine dumps, build and runtime information, the
+// route table and the effective configuration under opts.Prefix:
+//
+//	GET /              list the debug endpoints
+//	GET /pprof/        pprof index; profiles are at /pprof/{name}, as go tool pprof expects
+//	GET /goroutines    stack dump of every goroutine; ?debug=1 groups identical stacks
+//	GET /buildinfo     module and VCS information from debug.ReadBuildInfo
+//	GET /runtime       runtime.MemStats, goroutine count and uptime
+//	GET /routes        every route registered on the router
+//	GET /config        options passed to New and DebugOptions.Config, redacted
+//
+// The routes are mounted on the router behind opts.Middlewares, or served on
+// opts.Listener when it is set. Mounted routes skip the optional middleware added by the
+// other options, so that timeouts, rate limits and the like do not cut profiles short. It
+// panics if the routes would be mounted unprotected.
+func WithDebug(opts DebugOptions) Option {
+	if opts.Listener == nil && len(opts.Middlewares) == 0 {
+		panic("router: debug routes need Middlewares or a separate Listener")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultDebugPrefix
+	}
+	return func(c *config) {
+		c.debug = &opts
+	}
+}
+
+// debugRouter returns the debug routes for root, whose route table and settings they show
+func debugRouter(root chi.Routes, settings []setting, opts DebugOptions) http.Handler {
+	r := chi.NewRouter()
+	r.Use(opts.Middlewares...)
+	r.Use(middleware.NoCache)
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		httpx.RespondJSON(w, r, http.StatusOK, []string{
+			"pprof/", "goroutines", "buildinfo", "runtime", "routes", "config",
+		})
+	})
+
+	r.Get("/pprof", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+	})
+	r.Get("/pprof/", pprof.Index)
+	r.Get("/pprof/cmdline", pprof.Cmdline)
+	r.Get("/pprof/profile", pprof.Profile)
+	r.HandleFunc("/pprof/symbol", pprof.Symbol)
+	r.Get("/pprof/trace", pprof.Trace)
+	// pprof.Index only finds named profiles under /debug/pprof/, so serve them directly to
+	// support other prefixes
+	r.Get("/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+	})
+
+	r.Get("/goroutines", errorx.ErrorHandler(goroutines))
+	r.Get("/buildinfo", errorx.ErrorHandler(buildInfo))
+	r.Get("/runtime", func(w http.ResponseWriter, r *http.Request) {
+		info := runtimeInfo{
+			GoVersion:    runtime.Version(),
+			GOOS:         runtime.GOOS,
+			GOARCH:       runtime.GOARCH,
+			NumCPU:       runtime.NumCPU(),
+			GOMAXPROCS:   runtime.GOMAXPROCS(0),
+			NumGoroutine: runtime.NumGoroutine(),
+			NumCgoCall:   runtime.NumCgoCall(),
+			Uptime:       time.Since(started).Round(time.Second).String(),
+		}
+		runtime.ReadMemStats(&info.MemStats)
+		httpx.RespondJSON(w, r, http.StatusOK, info)
+	})
+
+	r.Get("/routes", func(w http.ResponseWriter, r *http.Request) {
+		// Walk on every request so that routes added after New are listed
+		routes := []routeInfo{}
+		chi.Walk(root, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+			routes = append(routes, routeInfo{
+				Method:      method,
+				Pattern:     route,
+				Handler:     enhancedmiddleware.HandlerName(handler),
+				Middlewares: len(middlewares),
+			})
+			return nil
+		})
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Pattern != routes[j].Pattern {
+				return routes[i].Pattern < routes[j].Pattern
+			}
+			return routes[i].Method < routes[j].Method
+		})
+		httpx.RespondJSON(w, r, http.StatusOK, routes)
+	})
+
+	r.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		rd := enhancedmiddleware.GetRedactor()
+		described := make([]setting, len(settings))
+		for i, s := range settings {
+			described[i] = setting{Option: s.Option, Config: describe(rd, nil, reflect.ValueOf(s.Config), 0)}
+		}
+		httpx.RespondJSON(w, r, http.StatusOK, map[string]any{
+			"router": described,
+			"app":    describe(rd, nil, reflect.ValueOf(opts.Config), 0),
+		})
+	})
+
+	return r
+}
+
+func goroutines(w http.ResponseWriter, r *http.Request) *errorx.ApiError {
+	level := 2
+	if v := r.URL.Query().Get("debug"); v != "" {
+		var err error
+		if level, err = strconv.Atoi(v); err != nil {
+			return errorx.BadRequestErr(fmt.Errorf("invalid debug level %q", v))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := rpprof.Lookup("goroutine").WriteTo(w, level); err != nil {
+		return errorx.InternalServerErr(err)
+	}
+	return nil
+}
+
+func buildInfo(w http.ResponseWriter, r *http.Request) *errorx.ApiError {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return errorx.NewApiError(errors.New("build info is not available"), http.StatusNotFound)
+	}
+	httpx.RespondJSON(w, r, http.StatusOK, info)
+	return nil
+}
+
+// serveDebug serves handler under opts.Prefix on opts.Listener until the server is shut
+// down or the listener closed
+func serveDebug(opts DebugOptions, handler http.Handler) {
+	mux := chi.NewRouter()
+	mux.Use(middleware.Recoverer)
+	mux.Mount(opts.Prefix, handler)
+
+	srv := opts.Server
+	if srv == nil {
+		srv = &http.Server{ReadHeaderTimeout: 10 * time.Second}
+	}
+	srv.Handler = mux
+	go func() {
+		err := srv.Serve(opts.Listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			logger.Error(context.Background(), "debug server stopped", logx.Err(err))
+		}
+	}()
+}
+
+// bypassPrefix applies middlewares to every request except those under prefix. The path is
+// matched the way chi routes it, so that no request reaches other routes without them.
+func bypassPrefix(prefix string, middlewares []func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		wrapped := chi.Chain(middlewares...).Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := r.URL.RawPath
+			if path == "" {
+				path = r.URL.Path
+			}
+			if path == prefix || strings.HasPrefix(path, prefix+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		})
+	}
+}
+
+// describe converts v into a value that encodes to readable JSON, masking members the
+// redactor flags. Structs become objects of their exported fields, functions their name,
+// and values with nothing exported their type.
+func describe(rd enhancedmiddleware.Redactor, path []string, v reflect.Value, depth int) any {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return nil
+		}
+	}
+	value := v.Interface()
+	if v.Kind() == reflect.String {
+		// Named string types get the redactor's value patterns too
+		value = v.String()
+	}
+	if redacted, ok := rd.Field(path, value); ok {
+		return redacted
+	}
+	if depth > maxDescribeDepth {
+		return v.Type().String()
+	}
+
+	switch x := v.Interface().(type) {
+	case encoding.TextMarshaler:
+		if text, err := x.MarshalText(); err == nil {
+			return string(text)
+		}
+	case error:
+		return x.Error()
+	case fmt.Stringer:
+		return x.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return describe(rd, path, v.Elem(), depth+1)
+	case reflect.Struct:
+		fields := make(map[string]any)
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.IsExported() {
+				fields[f.Name] = describe(rd, append(path[:len(path):len(path)], f.Name), v.Field(i), depth+1)
+			}
+		}
+		if len(fields) == 0 {
+			return v.Type().String()
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("[%d bytes]", v.Len())
+		}
+		elems := make([]any, v.Len())
+		for i := range elems {
+			elems[i] = describe(rd, append(path[:len(path):len(path)], "*"), v.Index(i), depth+1)
+		}
+		return elems
+	case reflect.Map:
+		members := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			members[key] = describe(rd, append(path[:len(path):len(path)], key), iter.Value(), depth+1)
+		}
+		return members
+	case reflect.Func:
+		return enhancedmiddleware.HandlerName(v.Interface())
+	case reflect.Chan, reflect.UnsafePointer:
+		return v.Type().String()
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,238 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/middleware/timeout"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Debug-Token") != "let-me-in" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func listUsers(w http.ResponseWriter, r *http.Request) {}
+
+func TestWithDebug(t *testing.T) {
+	type appConfig struct {
+		Name     string
+		Password string
+		Key      []byte
+	}
+
+	r := New(
+		WithTimeout(timeout.Options{Timeout: time.Minute}),
+		WithDebug(DebugOptions{
+			Middlewares: []func(http.Handler) http.Handler{requireToken},
+			Config:      appConfig{Name: "api", Password: "hunter2", Key: []byte("secret")},
+		}),
+	)
+	log.Logger = zerolog.New(io.Discard)
+	r.Get("/users", listUsers)
+
+	tests := []struct {
+		name         string
+		path         string
+		token        string
+		expectedCode int
+		expectedBody []string
+		unwantedBody []string
+	}{
+		{
+			name:         "unauthorized",
+			path:         "/debug/routes",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "routes",
+			path:         "/debug/routes",
+			token:        "let-me-in",
+			expectedCode: http.StatusOK,
+			expectedBody: []string{`"pattern":"/users","handler":"router.listUsers"`, `"pattern":"/debug/pprof/"`},
+		},
+		{
+			name:         "config",
+			path:         "/debug/config",
+			token:        "let-me-in",
+			expectedCode: http.StatusOK,
+			expectedBody: []string{
+				`"option":"WithTimeout","config":{`,
+				`"Timeout":"1m0s"`,
+				`"Name":"api"`,
+				`"Password":"[REDACTED]"`,
+				`"Key":"[6 bytes]"`,
+			},
+			unwantedBody: []string{"hunter2"},
+		},
+		{
+			name:         "runtime",
+			path:         "/debug/runtime",
+			token:        "let-me-in",
+			expectedCode: http.StatusOK,
+			expectedBody: []string{`"num_goroutine":`, `"memstats":{`},
+		},
+		{
+			name:         "goroutines",
+			path:         "/debug/goroutines",
+			token:        "let-me-in",
+			expectedCode: http.StatusOK,
+			expectedBody: []string{"goroutine "},
+		},
+		{
+			name:         "named profile",
+			path:         "/debug/pprof/heap?debug=1",
+			token:        "let-me-in",
+			expectedCode: http.StatusOK,
+			expectedBody: []string{"heap profile"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("X-Debug-Token", tt.token)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.expectedCode, rr.Body.String())
+			}
+			for _, expected := range tt.expectedBody {
+				if !strings.Contains(rr.Body.String(), expected) {
+					t.Errorf("body doesn't contain %q: %s", expected, rr.Body.String())
+				}
+			}
+			for _, unwanted := range tt.unwantedBody {
+				if strings.Contains(rr.Body.String(), unwanted) {
+					t.Errorf("body contains %q: %s", unwanted, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestWithDebugListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	srv := &http.Server{}
+	r := New(WithDebug(DebugOptions{Prefix: "/_debug", Listener: ln, Server: srv}))
+	log.Logger = zerolog.New(io.Discard)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/_debug/runtime", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("debug routes are mounted on the router: status %d", rr.Code)
+	}
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/_debug/buildinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var info struct{ GoVersion string }
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil || info.GoVersion == "" {
+		t.Errorf("buildinfo = %+v, %v", info, err)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/_debug/buildinfo"); err == nil {
+		t.Error("debug server still serving after Shutdown")
+	}
+}
+
+func TestWithDebugSkipsOptionalMiddleware(t *testing.T) {
+	r := New(
+		WithTimeout(timeout.Options{Timeout: 50 * time.Millisecond}),
+		WithDebug(DebugOptions{Middlewares: []func(http.Handler) http.Handler{requireToken}}),
+	)
+	log.Logger = zerolog.New(io.Discard)
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /slow status = %d, want the timeout to apply", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/pprof/profile?seconds=1", nil)
+	req.Header.Set("X-Debug-Token", "let-me-in")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.Len() == 0 {
+		t.Errorf("CPU profile status = %d with %d bytes, want a profile past the timeout", rr.Code, rr.Body.Len())
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	type apiKey string
+	type settings struct {
+		Name     string
+		Key      apiKey
+		Token    string
+		Secret   []byte
+		Handler  func(http.ResponseWriter, *http.Request)
+		internal string
+	}
+
+	rd := middleware.NewRedactor(middleware.RedactOptions{
+		ValuePatterns: []*regexp.Regexp{regexp.MustCompile(`sk_[a-z0-9]+`)},
+	})
+	got := describe(rd, nil, reflect.ValueOf(&settings{
+		Name:     "api",
+		Key:      "sk_live123",
+		Token:    "t0ps3cret",
+		Secret:   []byte("hunter2"),
+		Handler:  listUsers,
+		internal: "hidden",
+	}), 0)
+
+	expected := map[string]any{
+		"Name":    "api",
+		"Key":     "[REDACTED]",
+		"Token":   "[REDACTED]",
+		"Secret":  "[REDACTED]",
+		"Handler": "router.listUsers",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("describe() = %#v, want %#v", got, expected)
+	}
+}
+
+func TestWithDebugRequiresProtection(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic without Middlewares or Listener")
+		}
+	}()
+	WithDebug(DebugOptions{})
+}
@@ -2,28 +2,201 @@ package router
 
 import (
 	enhancedmiddleware "github.com/dfryer1193/mjolnir/middleware"
+	"github.com/dfryer1193/mjolnir/middleware/accesslog"
+	"github.com/dfryer1193/mjolnir/middleware/cache"
+	"github.com/dfryer1193/mjolnir/middleware/concurrency"
+	"github.com/dfryer1193/mjolnir/middleware/decompress"
+	"github.com/dfryer1193/mjolnir/middleware/idempotency"
+	"github.com/dfryer1193/mjolnir/middleware/loglevel"
+	"github.com/dfryer1193/mjolnir/middleware/ratelimit"
+	"github.com/dfryer1193/mjolnir/middleware/timeout"
+	"github.com/dfryer1193/mjolnir/utils/logx"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"net/http"
 	"os"
 	"time"
 )
 
+// Option customizes the router created by New
+type Option func(*config)
+
+type config struct {
+	logger      logx.Logger
+	proxies     enhancedmiddleware.ProxyOptions
+	middlewares []func(http.Handler) http.Handler
+	settings    []setting
+	debug       *DebugOptions
+}
+
+// record keeps the options passed to New for the debug /config endpoint
+func (c *config) record(option string, opts any) {
+	c.settings = append(c.settings, setting{Option: option, Config: opts})
+}
+
+// WithLogger sends mjolnir's logs to l, such as logx.Slog(handler), instead of zerolog's
+// global logger with console output
+func WithLogger(l logx.Logger) Option {
+	return func(c *config) {
+		c.record("WithLogger", l)
+		c.logger = l
+	}
+}
+
+// WithLogLevelOverride lets authorized requests raise the log level for themselves only
+func WithLogLevelOverride(opts loglevel.Options) Option {
+	return func(c *config) {
+		c.record("WithLogLevelOverride", opts)
+		c.middlewares = append(c.middlewares, loglevel.Override(opts))
+	}
+}
+
+// WithTrustedProxies honors forwarding headers from proxies in the given networks when
+// resolving the client address. Without it, forwarding headers are ignored.
+func WithTrustedProxies(opts enhancedmiddleware.ProxyOptions) Option {
+	return func(c *config) {
+		c.record("WithTrustedProxies", opts)
+		c.proxies = opts
+	}
+}
+
+// WithAccessLog writes an access log line for every request with logger. The caller owns
+// logger and should close it on shutdown.
+func WithAccessLog(logger *accesslog.Logger) Option {
+	return func(c *config) {
+		c.record("WithAccessLog", logger)
+		c.middlewares = append(c.middlewares, logger.Handler)
+	}
+}
+
+// WithBodyLogging adds request and response bodies to the request log
+func WithBodyLogging(opts enhancedmiddleware.BodyLogOptions) Option {
+	return func(c *config) {
+		c.record("WithBodyLogging", opts)
+		c.middlewares = append(c.middlewares, enhancedmiddleware.BodyLogger(opts))
+	}
+}
+
+// WithCompression enables response compression for every route
+func WithCompression(opts enhancedmiddleware.CompressOptions) Option {
+	return func(c *config) {
+		c.record("WithCompression", opts)
+		c.middlewares = append(c.middlewares, enhancedmiddleware.Compress(opts))
+	}
+}
+
+// WithCORS answers CORS preflights and adds CORS headers for every route
+func WithCORS(opts enhancedmiddleware.CORSOptions) Option {
+	return func(c *config) {
+		c.record("WithCORS", opts)
+		c.middlewares = append(c.middlewares, enhancedmiddleware.CORS(opts))
+	}
+}
+
+// WithSecurityHeaders sets browser security headers on every response
+func WithSecurityHeaders(opts enhancedmiddleware.SecurityHeadersOptions) Option {
+	return func(c *config) {
+		c.record("WithSecurityHeaders", opts)
+		c.middlewares = append(c.middlewares, enhancedmiddleware.SecurityHeaders(opts))
+	}
+}
+
+// WithRequestDecompression enables transparent decoding of compressed request bodies
+func WithRequestDecompression(opts decompress.Options) Option {
+	return func(c *config) {
+		c.record("WithRequestDecompression", opts)
+		c.middlewares = append(c.middlewares, decompress.New(opts))
+	}
+}
+
+// WithIdempotency replays stored responses for repeated requests carrying an idempotency
+// key on every route
+func WithIdempotency(opts idempotency.Options) Option {
+	return func(c *config) {
+		c.record("WithIdempotency", opts)
+		c.middlewares = append(c.middlewares, idempotency.New(opts))
+	}
+}
+
+// WithRateLimit limits requests across every route
+func WithRateLimit(opts ratelimit.Options) Option {
+	return func(c *config) {
+		c.record("WithRateLimit", opts)
+		c.middlewares = append(c.middlewares, ratelimit.New(opts))
+	}
+}
+
+// WithCache caches GET responses for every route that marks them cacheable
+func WithCache(opts cache.Options) Option {
+	return func(c *config) {
+		c.record("WithCache", opts)
+		c.middlewares = append(c.middlewares, cache.New(opts))
+	}
+}
+
+// WithConcurrencyLimit caps the number of requests in flight across every route and sheds
+// the excess. Route groups can have their own limits with concurrency.New.
+func WithConcurrencyLimit(opts concurrency.Options) Option {
+	return func(c *config) {
+		c.record("WithConcurrencyLimit", opts)
+		c.middlewares = append(c.middlewares, concurrency.New(opts))
+	}
+}
+
+// WithTimeout bounds how long every route may run. Individual routes can set a shorter
+// timeout with timeout.New.
+func WithTimeout(opts timeout.Options) Option {
+	return func(c *config) {
+		c.record("WithTimeout", opts)
+		c.middlewares = append(c.middlewares, timeout.New(opts))
+	}
+}
+
 // New creates a new pre-configured chi router
-func New() *chi.Mux {
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out:        os.Stdout,
-		TimeFormat: time.RFC3339Nano,
-	})
+func New(opts ...Option) *chi.Mux {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if cfg.logger != nil {
+		logx.SetLogger(cfg.logger)
+	} else {
+		log.Logger = log.Output(zerolog.ConsoleWriter{
+			Out:        os.Stdout,
+			TimeFormat: time.RFC3339Nano,
+		})
+	}
 	r := chi.NewRouter()
 
+	// Resolve the client address, honoring forwarding headers only from trusted proxies
+	r.Use(enhancedmiddleware.TrustedProxies(cfg.proxies))
+
 	// Add default chi middleware
-	r.Use(middleware.RealIP)
 	r.Use(middleware.Recoverer)
 
 	r.Use(enhancedmiddleware.RequestID)
 	r.Use(enhancedmiddleware.RequestLogger)
 
+	// Optional middleware runs inside the logger so it can contribute log fields. Debug
+	// routes mounted on the router skip it.
+	mountDebug := cfg.debug != nil && cfg.debug.Listener == nil
+	if mountDebug {
+		r.Use(bypassPrefix(cfg.debug.Prefix, cfg.middlewares))
+	} else {
+		r.Use(cfg.middlewares...)
+	}
+
+	if cfg.debug != nil {
+		debugRoutes := debugRouter(r, cfg.settings, *cfg.debug)
+		if mountDebug {
+			r.Mount(cfg.debug.Prefix, debugRoutes)
+		} else {
+			serveDebug(*cfg.debug, debugRoutes)
+		}
+	}
+
 	return r
 }
@@ -3,19 +3,24 @@ package errorx
 import (
 	"encoding/json"
 	"github.com/dfryer1193/mjolnir/middleware"
-	"github.com/rs/zerolog/log"
+	"github.com/dfryer1193/mjolnir/utils/logx"
+	"log/slog"
 	"net/http"
 )
 
+var logger = logx.Named("errorx")
+
 type ErrorReturningHandler func(w http.ResponseWriter, r *http.Request) *ApiError
 
 type ErrorResponse struct {
-	Error string `json:"error"`
-	Code  int    `json:"code"`
+	Error   string `json:"error"`
+	Code    int    `json:"code"`
+	Details any    `json:"details,omitempty"`
 }
 type ApiError struct {
-	err  error
-	code int
+	err     error
+	code    int
+	details any
 }
 
 func (e *ApiError) Error() string {
@@ -24,11 +29,18 @@ func (e *ApiError) Error() string {
 
 func (e *ApiError) asErrorResponse() ErrorResponse {
 	return ErrorResponse{
-		Error: e.err.Error(),
-		Code:  e.code,
+		Error:   e.err.Error(),
+		Code:    e.code,
+		Details: e.details,
 	}
 }
 
+// WithDetails attaches structured details that are included in the error response body
+func (e *ApiError) WithDetails(details any) *ApiError {
+	e.details = details
+	return e
+}
+
 func InternalServerErr(err error) *ApiError {
 	return &ApiError{
 		err:  err,
@@ -50,6 +62,55 @@ func UnauthorizedErr(err error) *ApiError {
 	}
 }
 
+func ForbiddenErr(err error) *ApiError {
+	return &ApiError{
+		err:  err,
+		code: http.StatusForbidden,
+	}
+}
+
+func ConflictErr(err error) *ApiError {
+	return &ApiError{
+		err:  err,
+		code: http.StatusConflict,
+	}
+}
+
+func PreconditionFailedErr(err error) *ApiError {
+	return &ApiError{
+		err:  err,
+		code: http.StatusPreconditionFailed,
+	}
+}
+
+func PayloadTooLargeErr(err error) *ApiError {
+	return &ApiError{
+		err:  err,
+		code: http.StatusRequestEntityTooLarge,
+	}
+}
+
+func UnsupportedMediaTypeErr(err error) *ApiError {
+	return &ApiError{
+		err:  err,
+		code: http.StatusUnsupportedMediaType,
+	}
+}
+
+func UnprocessableEntityErr(err error) *ApiError {
+	return &ApiError{
+		err:  err,
+		code: http.StatusUnprocessableEntity,
+	}
+}
+
+func TooManyRequestsErr(err error) *ApiError {
+	return &ApiError{
+		err:  err,
+		code: http.StatusTooManyRequests,
+	}
+}
+
 func NewApiError(err error, code int) *ApiError {
 	return &ApiError{
 		err:  err,
@@ -58,25 +119,54 @@ func NewApiError(err error, code int) *ApiError {
 }
 
 func ErrorHandler(h ErrorReturningHandler) http.HandlerFunc {
+	name := middleware.HandlerName(h)
 	return func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetHandlerName(r.Context(), name)
 		if err := h(w, r); err != nil {
 			handleError(w, r, err)
 		}
 	}
 }
 
+// HandleError writes reqErr as a JSON error response, for use by middleware that rejects
+// requests before they reach an ErrorReturningHandler
+func HandleError(w http.ResponseWriter, r *http.Request, reqErr *ApiError) {
+	handleError(w, r, reqErr)
+}
+
+// RespondError writes reqErr as a JSON error response carrying its own status and message,
+// even for 5xx codes, and without logging it. Middleware use it for expected conditions such
+// as timeouts and load shedding, whose messages are safe to show and which would flood the
+// error log during an incident.
+func RespondError(w http.ResponseWriter, reqErr *ApiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(reqErr.code)
+	json.NewEncoder(w).Encode(reqErr.asErrorResponse())
+}
+
 func handleError(w http.ResponseWriter, r *http.Request, reqErr *ApiError) {
 	if reqErr != nil {
 		w.Header().Set("Content-Type", "application/json")
 		encoder := json.NewEncoder(w)
 		if reqErr.code >= http.StatusInternalServerError {
-			log.Error().
-				Str("request_id", middleware.GetRequestID(r.Context())).
-				Err(reqErr.err).
-				Int("status", reqErr.code).
-				Str("path", r.URL.Path).
-				Str("method", r.Method).
-				Msg("internal server error occurred")
+			redactor := middleware.GetRedactor()
+			attrs := []slog.Attr{
+				slog.String("request_id", middleware.GetRequestID(r.Context())),
+				slog.Int("status", reqErr.code),
+				slog.String("path", r.URL.Path),
+				slog.String("method", r.Method),
+			}
+			if reqErr.err != nil {
+				message, _ := redactor.Field(nil, reqErr.err.Error())
+				attrs = append(attrs, slog.Any(logx.ErrorKey, message))
+			}
+			if r.URL.RawQuery != "" {
+				attrs = append(attrs, slog.String("query", middleware.RedactQuery(redactor, r.URL.RawQuery)))
+			}
+			if route, ok := middleware.GetRoute(r.Context()); ok {
+				attrs = append(attrs, middleware.RouteAttrs(route)...)
+			}
+			logger.Error(r.Context(), "internal server error occurred", attrs...)
 
 			w.WriteHeader(reqErr.code)
 			encoder.Encode(ErrorResponse{
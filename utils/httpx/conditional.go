@@ -0,0 +1,182 @@
+package httpx
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Validators describe the current state of a resource for conditional requests
+type Validators struct {
+	// ETag is a quoted entity tag, optionally prefixed with W/ for weak tags
+	ETag string
+	// LastModified is the modification time of the resource. The zero value disables
+	// date-based checks.
+	LastModified time.Time
+	// Exists marks a resource that exists but has neither validator, so that "*" matches it.
+	// Resources with an ETag or LastModified always exist.
+	Exists bool
+}
+
+func (v Validators) exists() bool {
+	return v.Exists || v.ETag != "" || !v.LastModified.IsZero()
+}
+
+// ConditionalOptions configures RespondJSONConditional
+type ConditionalOptions struct {
+	// Version is used as the entity tag instead of a hash of the encoded payload
+	Version string
+	// Weak marks the generated entity tag as weak
+	Weak bool
+	// LastModified is sent as the Last-Modified header and used for If-Modified-Since checks
+	LastModified time.Time
+}
+
+// ETag computes an entity tag from the given content
+func ETag(content []byte, weak bool) string {
+	sum := sha256.Sum256(content)
+	return VersionETag(base64.RawURLEncoding.EncodeToString(sum[:16]), weak)
+}
+
+// VersionETag formats a caller-provided version, such as a row revision, as an entity tag
+func VersionETag(version string, weak bool) string {
+	tag := `"` + strings.ReplaceAll(version, `"`, "") + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// RespondJSONConditional sends a JSON response with ETag and Last-Modified headers. Safe
+// requests whose If-None-Match or If-Modified-Since headers show the client's copy is
+// current receive 304 Not Modified with no body.
+func RespondJSONConditional(w http.ResponseWriter, r *http.Request, status int, payload interface{}, opts ConditionalOptions) error {
+	response, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	v := Validators{LastModified: opts.LastModified}
+	if opts.Version != "" {
+		v.ETag = VersionETag(opts.Version, opts.Weak)
+	} else {
+		v.ETag = ETag(response, opts.Weak)
+	}
+
+	if status == http.StatusOK && CheckNotModified(w, r, v) {
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if _, err := w.Write(response); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+
+	return nil
+}
+
+// CheckNotModified sets the validator headers on the response and, for GET and HEAD
+// requests whose cached representation is still current, writes 304 Not Modified.
+// It reports whether the response has been written.
+func CheckNotModified(w http.ResponseWriter, r *http.Request, v Validators) bool {
+	setValidatorHeaders(w, v)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, v.ETag, v.exists(), false) {
+			return false
+		}
+	} else if !notModifiedSince(r.Header.Get("If-Modified-Since"), v.LastModified) {
+		return false
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since and, for unsafe methods,
+// If-None-Match against the current validators of a resource. It returns a 412 error when
+// a precondition fails so that stale writes can be rejected.
+func CheckPreconditions(r *http.Request, v Validators) *errorx.ApiError {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !etagMatches(im, v.ETag, v.exists(), true) {
+			return errorx.PreconditionFailedErr(errors.New("resource has been modified"))
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !v.LastModified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && v.LastModified.Truncate(time.Second).After(t) {
+			return errorx.PreconditionFailedErr(errors.New("resource has been modified"))
+		}
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, v.ETag, v.exists(), false) {
+			return errorx.PreconditionFailedErr(errors.New("resource already exists"))
+		}
+	}
+
+	return nil
+}
+
+func setValidatorHeaders(w http.ResponseWriter, v Validators) {
+	if v.ETag != "" {
+		w.Header().Set("ETag", v.ETag)
+	}
+	if !v.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// etagMatches reports whether current matches any tag in the header list. "*" matches any
+// existing resource, with or without a tag. Strong comparison requires both tags to be
+// strong and identical; weak comparison ignores the W/ prefix.
+func etagMatches(header, current string, exists, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return exists
+		}
+		if current == "" {
+			continue
+		}
+		if strong {
+			if !isWeak(candidate) && !isWeak(current) && candidate == current {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(current, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isWeak(tag string) bool {
+	return strings.HasPrefix(tag, "W/")
+}
+
+func notModifiedSince(header string, lastModified time.Time) bool {
+	if header == "" || lastModified.IsZero() {
+		return false
+	}
+
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(t)
+}
@@ -0,0 +1,247 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	strong := ETag([]byte("hello"), false)
+	if !strings.HasPrefix(strong, `"`) || !strings.HasSuffix(strong, `"`) {
+		t.Errorf("strong ETag %s is not quoted", strong)
+	}
+	if strong != ETag([]byte("hello"), false) {
+		t.Error("ETag is not deterministic")
+	}
+	if strong == ETag([]byte("world"), false) {
+		t.Error("different content produced the same ETag")
+	}
+	if weak := ETag([]byte("hello"), true); weak != "W/"+strong {
+		t.Errorf("weak ETag = %s, want W/%s", weak, strong)
+	}
+	if got := VersionETag("v42", false); got != `"v42"` {
+		t.Errorf("VersionETag() = %s, want \"v42\"", got)
+	}
+}
+
+func TestRespondJSONConditional(t *testing.T) {
+	payload := map[string]string{"name": "widget"}
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	first := httptest.NewRecorder()
+	err := RespondJSONConditional(first, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, payload,
+		ConditionalOptions{LastModified: modified})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("ETag header not set")
+	}
+	if got := first.Header().Get("Last-Modified"); got != "Fri, 01 Mar 2024 12:00:00 GMT" {
+		t.Errorf("Last-Modified = %q", got)
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		headers      map[string]string
+		expectedCode int
+	}{
+		{
+			name:         "matching If-None-Match",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-None-Match": etag},
+			expectedCode: http.StatusNotModified,
+		},
+		{
+			name:         "weak If-None-Match in list",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-None-Match": `"other", W/` + etag},
+			expectedCode: http.StatusNotModified,
+		},
+		{
+			name:         "stale If-None-Match",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-None-Match": `"stale"`},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "If-Modified-Since after modification",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-Modified-Since": "Sat, 02 Mar 2024 00:00:00 GMT"},
+			expectedCode: http.StatusNotModified,
+		},
+		{
+			name:         "If-Modified-Since before modification",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-Modified-Since": "Thu, 29 Feb 2024 00:00:00 GMT"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:   "If-None-Match takes precedence over If-Modified-Since",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"If-None-Match":     `"stale"`,
+				"If-Modified-Since": "Sat, 02 Mar 2024 00:00:00 GMT",
+			},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "unsafe method is never 304",
+			method:       http.MethodPost,
+			headers:      map[string]string{"If-None-Match": etag},
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+
+			err := RespondJSONConditional(rr, req, http.StatusOK, payload, ConditionalOptions{LastModified: modified})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expectedCode == http.StatusNotModified && rr.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %q", rr.Body.String())
+			}
+			if rr.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %q, want %q", rr.Header().Get("ETag"), etag)
+			}
+		})
+	}
+}
+
+func TestRespondJSONConditionalVersion(t *testing.T) {
+	rr := httptest.NewRecorder()
+	err := RespondJSONConditional(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "x",
+		ConditionalOptions{Version: "7", Weak: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := rr.Header().Get("ETag"); got != `W/"7"` {
+		t.Errorf("ETag = %q, want W/\"7\"", got)
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	current := Validators{ETag: `"v2"`, LastModified: modified}
+
+	tests := []struct {
+		name         string
+		method       string
+		validators   Validators
+		headers      map[string]string
+		expectFailed bool
+	}{
+		{
+			name:       "matching If-Match",
+			method:     http.MethodPut,
+			validators: current,
+			headers:    map[string]string{"If-Match": `"v2"`},
+		},
+		{
+			name:         "stale If-Match",
+			method:       http.MethodPut,
+			validators:   current,
+			headers:      map[string]string{"If-Match": `"v1"`},
+			expectFailed: true,
+		},
+		{
+			name:         "weak If-Match never matches",
+			method:       http.MethodPut,
+			validators:   current,
+			headers:      map[string]string{"If-Match": `W/"v2"`},
+			expectFailed: true,
+		},
+		{
+			name:       "wildcard If-Match on existing resource",
+			method:     http.MethodPut,
+			validators: current,
+			headers:    map[string]string{"If-Match": "*"},
+		},
+		{
+			name:       "wildcard If-Match on existing resource without ETag",
+			method:     http.MethodPut,
+			validators: Validators{Exists: true},
+			headers:    map[string]string{"If-Match": "*"},
+		},
+		{
+			name:       "wildcard If-Match on resource with only Last-Modified",
+			method:     http.MethodPut,
+			validators: Validators{LastModified: modified},
+			headers:    map[string]string{"If-Match": "*"},
+		},
+		{
+			name:         "wildcard If-Match on missing resource",
+			method:       http.MethodPut,
+			validators:   Validators{},
+			headers:      map[string]string{"If-Match": "*"},
+			expectFailed: true,
+		},
+		{
+			name:         "If-Unmodified-Since before modification",
+			method:       http.MethodPatch,
+			validators:   current,
+			headers:      map[string]string{"If-Unmodified-Since": "Thu, 29 Feb 2024 00:00:00 GMT"},
+			expectFailed: true,
+		},
+		{
+			name:       "If-Unmodified-Since after modification",
+			method:     http.MethodPatch,
+			validators: current,
+			headers:    map[string]string{"If-Unmodified-Since": "Sat, 02 Mar 2024 00:00:00 GMT"},
+		},
+		{
+			name:         "If-None-Match wildcard on create of existing resource",
+			method:       http.MethodPut,
+			validators:   current,
+			headers:      map[string]string{"If-None-Match": "*"},
+			expectFailed: true,
+		},
+		{
+			name:       "no preconditions",
+			method:     http.MethodDelete,
+			validators: current,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			apiErr := CheckPreconditions(req, tt.validators)
+			if !tt.expectFailed {
+				if apiErr != nil {
+					t.Fatalf("unexpected error: %v", apiErr)
+				}
+				return
+			}
+
+			if apiErr == nil {
+				t.Fatal("expected precondition failure")
+			}
+			rr := httptest.NewRecorder()
+			errorHandlerFor(apiErr).ServeHTTP(rr, req)
+			if rr.Code != http.StatusPreconditionFailed {
+				t.Errorf("expected status 412, got %d", rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const (
+	// DefaultMaxFileSize is the per-file limit applied when MultipartOptions.MaxFileSize is zero
+	DefaultMaxFileSize int64 = 32 << 20
+	// DefaultMaxTotalSize is the request body limit applied when MultipartOptions.MaxTotalSize is zero
+	DefaultMaxTotalSize int64 = 64 << 20
+	// DefaultMaxFieldSize is the per-field limit applied when MultipartOptions.MaxFieldSize is zero
+	DefaultMaxFieldSize int64 = 1 << 20
+	// DefaultMaxFormSize is the request body limit applied by DecodeForm
+	DefaultMaxFormSize int64 = 10 << 20
+
+	sniffLen = 512
+)
+
+var errFileTooLarge = errors.New("file exceeds the maximum allowed size")
+
+// FileInfo describes a file part as received from the client
+type FileInfo struct {
+	Field    string
+	Filename string
+	// ContentType is the media type detected from the file contents, not the one declared by the client
+	ContentType string
+	Header      textproto.MIMEHeader
+}
+
+// StoredFile is a handle to file contents persisted by a FileSink
+type StoredFile interface {
+	Open() (io.ReadCloser, error)
+	Remove() error
+}
+
+// FileSink persists the contents of uploaded files as they are streamed from the request
+type FileSink interface {
+	Store(info FileInfo, r io.Reader) (StoredFile, error)
+}
+
+// UploadedFile is a file part that has been written to a FileSink
+type UploadedFile struct {
+	FileInfo
+	Size int64
+	StoredFile
+}
+
+// MultipartOptions configures ParseMultipart
+type MultipartOptions struct {
+	// Sink receives file contents. Defaults to TempDirSink("").
+	Sink FileSink
+	// MaxFileSize limits the size of each file. Defaults to DefaultMaxFileSize.
+	MaxFileSize int64
+	// MaxTotalSize limits the size of the whole request body. Defaults to DefaultMaxTotalSize.
+	MaxTotalSize int64
+	// MaxFieldSize limits the size of each non-file field. Defaults to DefaultMaxFieldSize.
+	MaxFieldSize int64
+	// MaxFiles limits the number of file parts. Zero means unlimited.
+	MaxFiles int
+	// AllowedTypes restricts files to the listed sniffed media types. Entries may use a
+	// wildcard subtype such as "image/*". Empty allows any type.
+	AllowedTypes []string
+}
+
+// MultipartForm holds the parsed contents of a multipart/form-data request
+type MultipartForm struct {
+	Values url.Values
+	Files  map[string][]*UploadedFile
+}
+
+// File returns the first file uploaded under the given field, or nil
+func (f *MultipartForm) File(field string) *UploadedFile {
+	if files := f.Files[field]; len(files) > 0 {
+		return files[0]
+	}
+	return nil
+}
+
+// Bind populates the struct pointed to by dst from fields tagged with `form`
+// using the same conversion rules as BindParams
+func (f *MultipartForm) Bind(dst any) *errorx.ApiError {
+	return bindForm(f.Values, dst)
+}
+
+// RemoveAll removes every stored file
+func (f *MultipartForm) RemoveAll() error {
+	var errs []error
+	for _, files := range f.Files {
+		for _, file := range files {
+			if err := file.Remove(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ParseMultipart streams a multipart/form-data request body, writing file parts to the
+// configured sink and collecting the remaining fields. Size violations result in a 413
+// error and disallowed or missing content types in a 415 error. Files stored before a
+// failure are removed.
+func ParseMultipart(r *http.Request, opts MultipartOptions) (*MultipartForm, *errorx.ApiError) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, errorx.UnsupportedMediaTypeErr(
+			fmt.Errorf("Content-Type %s is not supported", r.Header.Get("Content-Type")))
+	}
+
+	opts = opts.withDefaults()
+	body := http.MaxBytesReader(nil, r.Body, opts.MaxTotalSize)
+	defer body.Close()
+
+	form := &MultipartForm{
+		Values: url.Values{},
+		Files:  map[string][]*UploadedFile{},
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	fileCount := 0
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			form.RemoveAll()
+			return nil, formReadError(err)
+		}
+
+		var apiErr *errorx.ApiError
+		if part.FileName() == "" {
+			apiErr = readField(form, part, opts.MaxFieldSize)
+		} else {
+			fileCount++
+			if opts.MaxFiles > 0 && fileCount > opts.MaxFiles {
+				apiErr = errorx.PayloadTooLargeErr(fmt.Errorf("at most %d files may be uploaded", opts.MaxFiles))
+			} else {
+				apiErr = storeFile(form, part, opts)
+			}
+		}
+		part.Close()
+
+		if apiErr != nil {
+			form.RemoveAll()
+			return nil, apiErr
+		}
+	}
+}
+
+// DecodeForm parses an application/x-www-form-urlencoded request body and binds it to
+// the struct pointed to by dst using fields tagged with `form`
+func DecodeForm(r *http.Request, dst any) *errorx.ApiError {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		return errorx.UnsupportedMediaTypeErr(
+			fmt.Errorf("Content-Type %s is not supported", r.Header.Get("Content-Type")))
+	}
+
+	body := http.MaxBytesReader(nil, r.Body, DefaultMaxFormSize)
+	defer body.Close()
+
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return formReadError(err)
+	}
+
+	values, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return errorx.BadRequestErr(fmt.Errorf("failed to decode form: %w", err))
+	}
+	return bindForm(values, dst)
+}
+
+func bindForm(values url.Values, dst any) *errorx.ApiError {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errorx.InternalServerErr(fmt.Errorf("form binding requires a non-nil struct pointer, got %T", dst))
+	}
+
+	return bind(rv.Elem(), []string{SourceForm}, func(_, name string) []string {
+		return nonEmpty(values[name])
+	})
+}
+
+func (o MultipartOptions) withDefaults() MultipartOptions {
+	if o.Sink == nil {
+		o.Sink = TempDirSink("")
+	}
+	if o.MaxFileSize <= 0 {
+		o.MaxFileSize = DefaultMaxFileSize
+	}
+	if o.MaxTotalSize <= 0 {
+		o.MaxTotalSize = DefaultMaxTotalSize
+	}
+	if o.MaxFieldSize <= 0 {
+		o.MaxFieldSize = DefaultMaxFieldSize
+	}
+	return o
+}
+
+func readField(form *MultipartForm, part *multipart.Part, maxSize int64) *errorx.ApiError {
+	value, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+	if err != nil {
+		return formReadError(err)
+	}
+	if int64(len(value)) > maxSize {
+		return errorx.PayloadTooLargeErr(fmt.Errorf("field %q exceeds the maximum allowed size", part.FormName()))
+	}
+
+	form.Values.Add(part.FormName(), string(value))
+	return nil
+}
+
+func storeFile(form *MultipartForm, part *multipart.Part, opts MultipartOptions) *errorx.ApiError {
+	buffered := bufio.NewReaderSize(part, sniffLen)
+	head, err := buffered.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return formReadError(err)
+	}
+
+	info := FileInfo{
+		Field:       part.FormName(),
+		Filename:    part.FileName(),
+		ContentType: http.DetectContentType(head),
+		Header:      part.Header,
+	}
+	if !mediaTypeAllowed(info.ContentType, opts.AllowedTypes) {
+		return errorx.UnsupportedMediaTypeErr(
+			fmt.Errorf("file %q has unsupported content type %s", info.Filename, info.ContentType))
+	}
+
+	counter := &limitedCounter{r: buffered, limit: opts.MaxFileSize}
+	stored, err := opts.Sink.Store(info, counter)
+	if err != nil {
+		if stored != nil {
+			stored.Remove()
+		}
+		if errors.Is(err, errFileTooLarge) {
+			return errorx.PayloadTooLargeErr(fmt.Errorf("file %q exceeds the maximum allowed size", info.Filename))
+		}
+		return formReadError(err)
+	}
+
+	form.Files[info.Field] = append(form.Files[info.Field], &UploadedFile{
+		FileInfo:   info,
+		Size:       counter.n,
+		StoredFile: stored,
+	})
+	return nil
+}
+
+func formReadError(err error) *errorx.ApiError {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return errorx.PayloadTooLargeErr(fmt.Errorf("request body exceeds %d bytes", maxBytesErr.Limit))
+	}
+	return errorx.BadRequestErr(fmt.Errorf("failed to read form: %w", err))
+}
+
+func mediaTypeAllowed(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == mediaType || a == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// limitedCounter counts bytes read and fails once more than limit bytes have been read
+type limitedCounter struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (c *limitedCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.n > c.limit {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// TempDirSink returns a FileSink that writes each file to a new temporary file in dir.
+// An empty dir uses os.TempDir.
+func TempDirSink(dir string) FileSink {
+	return tempDirSink{dir: dir}
+}
+
+type tempDirSink struct {
+	dir string
+}
+
+func (s tempDirSink) Store(_ FileInfo, r io.Reader) (StoredFile, error) {
+	f, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	stored := TempFile{Path: f.Name()}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return stored, err
+	}
+	if err := f.Close(); err != nil {
+		return stored, fmt.Errorf("failed to close temp file: %w", err)
+	}
+	return stored, nil
+}
+
+// TempFile is a StoredFile on the local filesystem
+type TempFile struct {
+	Path string
+}
+
+func (f TempFile) Open() (io.ReadCloser, error) {
+	return os.Open(f.Path)
+}
+
+func (f TempFile) Remove() error {
+	if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// MemorySink returns a FileSink that buffers each file in memory
+func MemorySink() FileSink {
+	return memorySink{}
+}
+
+type memorySink struct{}
+
+func (memorySink) Store(_ FileInfo, r io.Reader) (StoredFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return MemoryFile{Data: data}, nil
+}
+
+// MemoryFile is a StoredFile held in memory
+type MemoryFile struct {
+	Data []byte
+}
+
+func (f MemoryFile) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.Data)), nil
+}
+
+func (f MemoryFile) Remove() error {
+	return nil
+}
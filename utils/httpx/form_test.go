@@ -0,0 +1,290 @@
+package httpx
+
+import (
+	"bytes"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+type multipartPart struct {
+	field    string
+	filename string
+	content  []byte
+}
+
+func newMultipartRequest(t *testing.T, parts []multipartPart) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var w io.Writer
+		var err error
+		if p.filename != "" {
+			w, err = writer.CreateFormFile(p.field, p.filename)
+		} else {
+			w, err = writer.CreateFormField(p.field)
+		}
+		if err != nil {
+			t.Fatalf("failed to create part: %v", err)
+		}
+		w.Write(p.content)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestParseMultipart(t *testing.T) {
+	tests := []struct {
+		name         string
+		parts        []multipartPart
+		opts         MultipartOptions
+		contentType  string
+		expectedCode int
+	}{
+		{
+			name: "fields and file",
+			parts: []multipartPart{
+				{field: "title", content: []byte("holiday")},
+				{field: "photo", filename: "a.png", content: append(pngHeader, make([]byte, 100)...)},
+			},
+			opts: MultipartOptions{Sink: MemorySink(), AllowedTypes: []string{"image/*"}},
+		},
+		{
+			name: "file too large",
+			parts: []multipartPart{
+				{field: "photo", filename: "a.png", content: append(pngHeader, make([]byte, 100)...)},
+			},
+			opts:         MultipartOptions{Sink: MemorySink(), MaxFileSize: 50},
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "total too large",
+			parts: []multipartPart{
+				{field: "a", filename: "a.txt", content: bytes.Repeat([]byte("a"), 600)},
+				{field: "b", filename: "b.txt", content: bytes.Repeat([]byte("b"), 600)},
+			},
+			opts:         MultipartOptions{Sink: MemorySink(), MaxTotalSize: 1000},
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "too many files",
+			parts: []multipartPart{
+				{field: "a", filename: "a.txt", content: []byte("a")},
+				{field: "b", filename: "b.txt", content: []byte("b")},
+			},
+			opts:         MultipartOptions{Sink: MemorySink(), MaxFiles: 1},
+			expectedCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "disallowed type",
+			parts: []multipartPart{
+				{field: "photo", filename: "a.png", content: []byte("plain text pretending to be a png")},
+			},
+			opts:         MultipartOptions{Sink: MemorySink(), AllowedTypes: []string{"image/png"}},
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:         "not multipart",
+			contentType:  "application/json",
+			opts:         MultipartOptions{Sink: MemorySink()},
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newMultipartRequest(t, tt.parts)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			form, apiErr := ParseMultipart(req, tt.opts)
+
+			if tt.expectedCode != 0 {
+				if apiErr == nil {
+					t.Fatalf("expected error with status %d", tt.expectedCode)
+				}
+				rr := httptest.NewRecorder()
+				errorHandlerFor(apiErr).ServeHTTP(rr, req)
+				if rr.Code != tt.expectedCode {
+					t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+				}
+				return
+			}
+
+			if apiErr != nil {
+				t.Fatalf("unexpected error: %v", apiErr)
+			}
+			if got := form.Values.Get("title"); got != "holiday" {
+				t.Errorf("title = %q, want %q", got, "holiday")
+			}
+
+			photo := form.File("photo")
+			if photo == nil {
+				t.Fatal("photo was not stored")
+			}
+			if photo.ContentType != "image/png" || photo.Filename != "a.png" || photo.Size != 108 {
+				t.Errorf("unexpected file info: %+v", photo.FileInfo)
+			}
+
+			rc, err := photo.Open()
+			if err != nil {
+				t.Fatalf("failed to open stored file: %v", err)
+			}
+			defer rc.Close()
+			data, _ := io.ReadAll(rc)
+			if !bytes.HasPrefix(data, pngHeader) || len(data) != 108 {
+				t.Errorf("stored file contents do not match upload")
+			}
+		})
+	}
+}
+
+func TestParseMultipartTempDirSink(t *testing.T) {
+	dir := t.TempDir()
+	req := newMultipartRequest(t, []multipartPart{
+		{field: "doc", filename: "doc.txt", content: []byte("hello")},
+	})
+
+	form, apiErr := ParseMultipart(req, MultipartOptions{Sink: TempDirSink(dir)})
+	if apiErr != nil {
+		t.Fatalf("unexpected error: %v", apiErr)
+	}
+
+	stored, ok := form.File("doc").StoredFile.(TempFile)
+	if !ok {
+		t.Fatalf("expected TempFile, got %T", form.File("doc").StoredFile)
+	}
+	if !strings.HasPrefix(stored.Path, dir) {
+		t.Errorf("file stored at %s, want inside %s", stored.Path, dir)
+	}
+
+	if err := form.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll() failed: %v", err)
+	}
+	if _, err := os.Stat(stored.Path); !os.IsNotExist(err) {
+		t.Error("stored file was not removed")
+	}
+}
+
+func TestParseMultipartRemovesFilesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	req := newMultipartRequest(t, []multipartPart{
+		{field: "a", filename: "a.txt", content: []byte("small")},
+		{field: "b", filename: "b.txt", content: bytes.Repeat([]byte("b"), 100)},
+	})
+
+	_, apiErr := ParseMultipart(req, MultipartOptions{Sink: TempDirSink(dir), MaxFileSize: 10})
+	if apiErr == nil {
+		t.Fatal("expected error")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected temp dir to be empty, found %d files", len(entries))
+	}
+}
+
+func TestMultipartFormBind(t *testing.T) {
+	req := newMultipartRequest(t, []multipartPart{
+		{field: "title", content: []byte("report")},
+		{field: "count", content: []byte("3")},
+	})
+
+	form, apiErr := ParseMultipart(req, MultipartOptions{Sink: MemorySink()})
+	if apiErr != nil {
+		t.Fatalf("unexpected error: %v", apiErr)
+	}
+
+	var fields struct {
+		Title string `form:"title"`
+		Count int    `form:"count"`
+	}
+	if err := form.Bind(&fields); err != nil {
+		t.Fatalf("unexpected bind error: %v", err)
+	}
+	if fields.Title != "report" || fields.Count != 3 {
+		t.Errorf("unexpected bound fields: %+v", fields)
+	}
+}
+
+func TestDecodeForm(t *testing.T) {
+	type login struct {
+		User     string `form:"user"`
+		Remember bool   `form:"remember" default:"false"`
+	}
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		expected     login
+		expectedCode int
+	}{
+		{
+			name:        "valid form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "user=alice&remember=true",
+			expected:    login{User: "alice", Remember: true},
+		},
+		{
+			name:         "missing field",
+			contentType:  "application/x-www-form-urlencoded",
+			body:         "remember=true",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "wrong content type",
+			contentType:  "application/json",
+			body:         `{"user":"alice"}`,
+			expectedCode: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			var got login
+			apiErr := DecodeForm(req, &got)
+
+			if tt.expectedCode != 0 {
+				if apiErr == nil {
+					t.Fatalf("expected error with status %d", tt.expectedCode)
+				}
+				rr := httptest.NewRecorder()
+				errorHandlerFor(apiErr).ServeHTTP(rr, req)
+				if rr.Code != tt.expectedCode {
+					t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+				}
+				return
+			}
+
+			if apiErr != nil {
+				t.Fatalf("unexpected error: %v", apiErr)
+			}
+			if got != tt.expected {
+				t.Errorf("got %+v, want %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func errorHandlerFor(apiErr *errorx.ApiError) http.Handler {
+	return errorx.ErrorHandler(func(w http.ResponseWriter, r *http.Request) *errorx.ApiError {
+		return apiErr
+	})
+}
@@ -0,0 +1,365 @@
+package httpx
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/optional"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parameter sources understood by the binders and used as struct tag names
+const (
+	SourcePath   = "path"
+	SourceQuery  = "query"
+	SourceHeader = "header"
+	SourceForm   = "form"
+)
+
+var (
+	errMissing = errors.New("required parameter is missing")
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	uuidType            = reflect.TypeOf(uuid.UUID{})
+)
+
+// ParamError describes a single parameter that could not be bound
+type ParamError struct {
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("invalid %s parameter %q: %s", e.Source, e.Name, e.Reason)
+}
+
+// PathParam parses the named chi URL parameter into T
+func PathParam[T any](r *http.Request, name string) (T, error) {
+	return requiredParam[T](SourcePath, name, lookup(r, SourcePath, name))
+}
+
+// QueryParam parses the named query parameter into T. Slice types accept
+// repeated and comma-separated values.
+func QueryParam[T any](r *http.Request, name string) (T, error) {
+	return requiredParam[T](SourceQuery, name, lookup(r, SourceQuery, name))
+}
+
+// HeaderParam parses the named request header into T
+func HeaderParam[T any](r *http.Request, name string) (T, error) {
+	return requiredParam[T](SourceHeader, name, lookup(r, SourceHeader, name))
+}
+
+// OptionalQueryParam parses the named query parameter into T, returning an
+// empty option when it is absent
+func OptionalQueryParam[T any](r *http.Request, name string) (optional.Option[T], error) {
+	return optionalParam[T](SourceQuery, name, lookup(r, SourceQuery, name))
+}
+
+// OptionalHeaderParam parses the named request header into T, returning an
+// empty option when it is absent
+func OptionalHeaderParam[T any](r *http.Request, name string) (optional.Option[T], error) {
+	return optionalParam[T](SourceHeader, name, lookup(r, SourceHeader, name))
+}
+
+// BindParams populates the struct pointed to by dst from fields tagged with
+// `path`, `query` or `header`. Fields of type optional.Option are left empty
+// when the parameter is absent, a `default` tag supplies a fallback value, and
+// all other fields are required. Time fields accept a `layout` tag (RFC 3339 by
+// default) and an `enum` tag restricts values to a comma-separated list.
+//
+// Every failure is collected into a single 400 error whose details list the
+// offending parameters.
+func BindParams(r *http.Request, dst any) *errorx.ApiError {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errorx.InternalServerErr(fmt.Errorf("BindParams requires a non-nil struct pointer, got %T", dst))
+	}
+
+	return bind(rv.Elem(), []string{SourcePath, SourceQuery, SourceHeader}, func(source, name string) []string {
+		return lookup(r, source, name)
+	})
+}
+
+// valueGetter returns the raw values of the named parameter from the given source
+type valueGetter func(source, name string) []string
+
+func bind(v reflect.Value, sources []string, get valueGetter) *errorx.ApiError {
+	var failures []*ParamError
+	bindStruct(v, sources, get, &failures)
+	if len(failures) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(failures))
+	for i, f := range failures {
+		errs[i] = f
+	}
+	return errorx.BadRequestErr(fmt.Errorf("invalid request parameters: %w", errors.Join(errs...))).
+		WithDetails(failures)
+}
+
+func bindStruct(v reflect.Value, sources []string, get valueGetter, failures *[]*ParamError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		source, name := paramTag(field, sources)
+		if source == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				bindStruct(v.Field(i), sources, get, failures)
+			}
+			continue
+		}
+
+		if err := bindField(v.Field(i), field, get(source, name)); err != nil {
+			*failures = append(*failures, &ParamError{Source: source, Name: name, Reason: err.Error()})
+		}
+	}
+}
+
+func bindField(fv reflect.Value, field reflect.StructField, raw []string) error {
+	opts := parseOptions{layout: field.Tag.Get("layout")}
+	if enum, ok := field.Tag.Lookup("enum"); ok {
+		opts.enum = strings.Split(enum, ",")
+	}
+
+	if len(raw) == 0 {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			raw = []string{def}
+		}
+	}
+
+	if elem, ok := optionElem(field.Type); ok {
+		if len(raw) == 0 {
+			fv.Addr().MethodByName("Clear").Call(nil)
+			return nil
+		}
+		parsed, err := parseValue(elem, raw, opts)
+		if err != nil {
+			return err
+		}
+		fv.Addr().MethodByName("Set").Call([]reflect.Value{parsed})
+		return nil
+	}
+
+	if len(raw) == 0 {
+		return errMissing
+	}
+	parsed, err := parseValue(field.Type, raw, opts)
+	if err != nil {
+		return err
+	}
+	fv.Set(parsed)
+	return nil
+}
+
+func paramTag(field reflect.StructField, sources []string) (string, string) {
+	for _, source := range sources {
+		if name, ok := field.Tag.Lookup(source); ok && name != "-" {
+			if name == "" {
+				name = field.Name
+			}
+			return source, name
+		}
+	}
+	return "", ""
+}
+
+func lookup(r *http.Request, source, name string) []string {
+	var values []string
+	switch source {
+	case SourcePath:
+		if v := chi.URLParam(r, name); v != "" {
+			values = []string{v}
+		}
+	case SourceQuery:
+		values = r.URL.Query()[name]
+	case SourceHeader:
+		values = r.Header.Values(name)
+	}
+
+	return nonEmpty(values)
+}
+
+func nonEmpty(values []string) []string {
+	present := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			present = append(present, v)
+		}
+	}
+	return present
+}
+
+func requiredParam[T any](source, name string, raw []string) (T, error) {
+	var zero T
+	if len(raw) == 0 {
+		return zero, &ParamError{Source: source, Name: name, Reason: errMissing.Error()}
+	}
+
+	parsed, err := parseValue(reflect.TypeOf(&zero).Elem(), raw, parseOptions{})
+	if err != nil {
+		return zero, &ParamError{Source: source, Name: name, Reason: err.Error()}
+	}
+	return parsed.Interface().(T), nil
+}
+
+func optionalParam[T any](source, name string, raw []string) (optional.Option[T], error) {
+	if len(raw) == 0 {
+		return optional.Empty[T](), nil
+	}
+
+	value, err := requiredParam[T](source, name, raw)
+	if err != nil {
+		return optional.Empty[T](), err
+	}
+	return optional.Some(value), nil
+}
+
+type parseOptions struct {
+	layout string
+	enum   []string
+}
+
+// optionElem reports whether t is an optional.Option and, if so, its element type
+func optionElem(t reflect.Type) (reflect.Type, bool) {
+	optType := reflect.TypeOf(optional.Option[struct{}]{})
+	if t.Kind() != reflect.Struct || t.PkgPath() != optType.PkgPath() || !strings.HasPrefix(t.Name(), "Option[") {
+		return nil, false
+	}
+
+	set, ok := reflect.PointerTo(t).MethodByName("Set")
+	if !ok {
+		return nil, false
+	}
+	return set.Type.In(1), true
+}
+
+func parseValue(t reflect.Type, raw []string, opts parseOptions) (reflect.Value, error) {
+	if t.Kind() == reflect.Slice && !reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		var parts []string
+		for _, v := range raw {
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					parts = append(parts, p)
+				}
+			}
+		}
+
+		slice := reflect.MakeSlice(t, 0, len(parts))
+		for _, p := range parts {
+			elem, err := parseScalar(t.Elem(), p, opts)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		return slice, nil
+	}
+
+	return parseScalar(t, raw[0], opts)
+}
+
+func parseScalar(t reflect.Type, raw string, opts parseOptions) (reflect.Value, error) {
+	if len(opts.enum) > 0 && !containsString(opts.enum, raw) {
+		return reflect.Value{}, fmt.Errorf("must be one of %s", strings.Join(opts.enum, ", "))
+	}
+
+	if t.Kind() == reflect.Pointer {
+		elem, err := parseScalar(t.Elem(), raw, opts)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+
+	switch t {
+	case timeType:
+		layout := opts.layout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		parsed, err := time.Parse(layout, raw)
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("must be a time in the format %q", layout)
+		}
+		return reflect.ValueOf(parsed), nil
+	case durationType:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return reflect.Value{}, errors.New("must be a duration")
+		}
+		return reflect.ValueOf(parsed), nil
+	case uuidType:
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			return reflect.Value{}, errors.New("must be a UUID")
+		}
+		return reflect.ValueOf(parsed), nil
+	}
+
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		ptr := reflect.New(t)
+		if err := ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw)); err != nil {
+			return reflect.Value{}, err
+		}
+		return ptr.Elem(), nil
+	}
+
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return reflect.Value{}, errors.New("must be a boolean")
+		}
+		v.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, errors.New("must be an integer")
+		}
+		v.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, errors.New("must be a non-negative integer")
+		}
+		v.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, t.Bits())
+		if err != nil {
+			return reflect.Value{}, errors.New("must be a number")
+		}
+		v.SetFloat(parsed)
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported parameter type %s", t)
+	}
+	return v, nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/dfryer1193/mjolnir/utils/errorx"
+	"github.com/dfryer1193/mjolnir/utils/optional"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type color string
+
+func (c *color) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "red", "green", "blue":
+		*c = color(text)
+		return nil
+	}
+	return errors.New("must be one of red, green, blue")
+}
+
+func withURLParams(r *http.Request, params map[string]string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestPathParam(t *testing.T) {
+	id := uuid.New()
+	req := withURLParams(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{
+		"id":   "42",
+		"uuid": id.String(),
+		"bad":  "abc",
+	})
+
+	n, err := PathParam[int](req, "id")
+	if err != nil || n != 42 {
+		t.Errorf("PathParam[int] = %v, %v; want 42, nil", n, err)
+	}
+
+	u, err := PathParam[uuid.UUID](req, "uuid")
+	if err != nil || u != id {
+		t.Errorf("PathParam[uuid.UUID] = %v, %v; want %v, nil", u, err, id)
+	}
+
+	_, err = PathParam[int](req, "bad")
+	var paramErr *ParamError
+	if !errors.As(err, &paramErr) {
+		t.Fatalf("expected ParamError, got %v", err)
+	}
+	if paramErr.Source != SourcePath || paramErr.Name != "bad" {
+		t.Errorf("unexpected ParamError %+v", paramErr)
+	}
+
+	if _, err := PathParam[string](req, "missing"); err == nil {
+		t.Error("expected error for missing path parameter")
+	}
+}
+
+func TestQueryParam(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		parse       func(r *http.Request) (any, error)
+		expected    any
+		expectError bool
+	}{
+		{
+			name:  "int",
+			query: "limit=10",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[int](r, "limit")
+			},
+			expected: 10,
+		},
+		{
+			name:  "bool",
+			query: "verbose=true",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[bool](r, "verbose")
+			},
+			expected: true,
+		},
+		{
+			name:  "repeated slice",
+			query: "id=1&id=2",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[[]int](r, "id")
+			},
+			expected: []int{1, 2},
+		},
+		{
+			name:  "comma separated slice",
+			query: "tag=a,b,c",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[[]string](r, "tag")
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:  "time",
+			query: "since=2024-01-02T03:04:05Z",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[time.Time](r, "since")
+			},
+			expected: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			name:  "duration",
+			query: "ttl=1m30s",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[time.Duration](r, "ttl")
+			},
+			expected: 90 * time.Second,
+		},
+		{
+			name:  "text unmarshaler enum",
+			query: "color=green",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[color](r, "color")
+			},
+			expected: color("green"),
+		},
+		{
+			name:  "invalid enum",
+			query: "color=purple",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[color](r, "color")
+			},
+			expectError: true,
+		},
+		{
+			name:  "overflow",
+			query: "n=300",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[int8](r, "n")
+			},
+			expectError: true,
+		},
+		{
+			name:  "missing",
+			query: "",
+			parse: func(r *http.Request) (any, error) {
+				return QueryParam[int](r, "limit")
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			got, err := tt.parse(req)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error, got value %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOptionalParams(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/?page=3", nil)
+	req.Header.Set("X-Retries", "2")
+
+	page, err := OptionalQueryParam[int](req, "page")
+	if err != nil || page.IsEmpty() || page.Get() != 3 {
+		t.Errorf("OptionalQueryParam(page) = %v, %v; want Some(3)", page, err)
+	}
+
+	size, err := OptionalQueryParam[int](req, "size")
+	if err != nil || !size.IsEmpty() {
+		t.Errorf("OptionalQueryParam(size) = %v, %v; want Empty", size, err)
+	}
+
+	retries, err := OptionalHeaderParam[int](req, "X-Retries")
+	if err != nil || retries.IsEmpty() || retries.Get() != 2 {
+		t.Errorf("OptionalHeaderParam(X-Retries) = %v, %v; want Some(2)", retries, err)
+	}
+}
+
+func TestBindParams(t *testing.T) {
+	type Tracing struct {
+		Trace string `header:"X-Trace"`
+	}
+	type params struct {
+		Tracing
+		ID      int                        `path:"id"`
+		Limit   int                        `query:"limit" default:"20"`
+		Sort    string                     `query:"sort" enum:"asc,desc"`
+		Tags    []string                   `query:"tag"`
+		Since   optional.Option[time.Time] `query:"since" layout:"2006-01-02"`
+		Cursor  optional.Option[string]    `query:"cursor"`
+		ignored string
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/?sort=asc&tag=a&tag=b&since=2024-05-06", nil)
+	req.Header.Set("X-Trace", "abc")
+	req = withURLParams(req, map[string]string{"id": "7"})
+
+	var p params
+	if err := BindParams(req, &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p.ID != 7 || p.Limit != 20 || p.Sort != "asc" || p.Trace != "abc" {
+		t.Errorf("unexpected scalar fields: %+v", p)
+	}
+	if !reflect.DeepEqual(p.Tags, []string{"a", "b"}) {
+		t.Errorf("Tags = %v, want [a b]", p.Tags)
+	}
+	if p.Since.IsEmpty() || !p.Since.Get().Equal(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Since = %v, want 2024-05-06", p.Since)
+	}
+	if !p.Cursor.IsEmpty() {
+		t.Errorf("Cursor = %v, want empty", p.Cursor)
+	}
+}
+
+func TestBindParamsAggregatesErrors(t *testing.T) {
+	type params struct {
+		ID    int    `path:"id"`
+		Limit int    `query:"limit"`
+		Sort  string `query:"sort" enum:"asc,desc"`
+	}
+
+	handler := errorx.ErrorHandler(func(w http.ResponseWriter, r *http.Request) *errorx.ApiError {
+		var p params
+		if err := BindParams(withURLParams(r, map[string]string{"id": "x"}), &p); err != nil {
+			return err
+		}
+		return nil
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/?sort=up", nil))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+
+	var resp struct {
+		Error   string       `json:"error"`
+		Details []ParamError `json:"details"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
+	}
+
+	if len(resp.Details) != 3 {
+		t.Fatalf("expected 3 parameter errors, got %d: %+v", len(resp.Details), resp.Details)
+	}
+	for _, name := range []string{"id", "limit", "sort"} {
+		if !strings.Contains(resp.Error, `"`+name+`"`) {
+			t.Errorf("error message %q does not mention %s", resp.Error, name)
+		}
+	}
+}
+
+func TestBindParamsRejectsNonStruct(t *testing.T) {
+	var n int
+	err := BindParams(httptest.NewRequest(http.MethodGet, "/", nil), &n)
+	if err == nil {
+		t.Fatal("expected error for non-struct destination")
+	}
+}
@@ -0,0 +1,288 @@
+package logx
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Global names the level that applies to loggers without a level of their own
+const Global = "global"
+
+// DefaultLevel is the global level until it is changed with SetLevel
+const DefaultLevel = zerolog.DebugLevel
+
+// inherit marks a named logger that follows the global level, or a global level left at
+// DefaultLevel
+const inherit int32 = -128
+
+// LevelInfo describes the level of a logger
+type LevelInfo struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	// Inherited is set when the logger follows the global level
+	Inherited bool `json:"inherited,omitempty"`
+	// RevertAt is when a temporary level reverts
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+type levelEntry struct {
+	level atomic.Int32
+
+	// The fields below are guarded by registry.mu
+	prev       int32
+	revertAt   time.Time
+	generation uint64
+}
+
+// effective returns the level in effect for e, and whether it was set with SetLevel rather
+// than left at DefaultLevel
+func (e *levelEntry) effective() (zerolog.Level, bool) {
+	if l := e.level.Load(); l != inherit {
+		return zerolog.Level(l), true
+	}
+	if l := global.level.Load(); l != inherit {
+		return zerolog.Level(l), true
+	}
+	return DefaultLevel, false
+}
+
+var (
+	registry = struct {
+		mu      sync.Mutex
+		entries map[string]*levelEntry
+	}{entries: make(map[string]*levelEntry)}
+	global = entry(Global)
+	// std is the logger behind the package-level functions
+	std = &NamedLogger{name: Global, entry: global}
+)
+
+// entry returns the level entry for name, creating it if needed
+func entry(name string) *levelEntry {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return entryLocked(name)
+}
+
+func entryLocked(name string) *levelEntry {
+	e, ok := registry.entries[name]
+	if !ok {
+		e = &levelEntry{}
+		e.level.Store(inherit)
+		registry.entries[name] = e
+	}
+	return e
+}
+
+// SetLevel sets the level of the named logger, or of every logger without its own level
+// when name is Global. A positive revertAfter restores the level in effect before the
+// first of a run of temporary changes once it elapses.
+func SetLevel(name string, level zerolog.Level, revertAfter time.Duration) {
+	setLevel(name, int32(level), revertAfter)
+}
+
+// ResetLevel makes the named logger follow the global level again, or restores
+// DefaultLevel when name is Global. Pending reverts are cancelled.
+func ResetLevel(name string) {
+	setLevel(name, inherit, 0)
+}
+
+func setLevel(name string, level int32, revertAfter time.Duration) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	e := entryLocked(name)
+	if e.revertAt.IsZero() {
+		e.prev = e.level.Load()
+	}
+	e.level.Store(level)
+	e.generation++
+	e.revertAt = time.Time{}
+	if revertAfter <= 0 {
+		return
+	}
+
+	e.revertAt = time.Now().Add(revertAfter)
+	generation := e.generation
+	time.AfterFunc(revertAfter, func() {
+		registry.mu.Lock()
+		defer registry.mu.Unlock()
+		// A later change supersedes this revert
+		if e.generation == generation {
+			e.level.Store(e.prev)
+			e.revertAt = time.Time{}
+			e.generation++
+		}
+	})
+}
+
+// GetLevel returns the level in effect for the named logger
+func GetLevel(name string) zerolog.Level {
+	level, _ := entry(name).effective()
+	return level
+}
+
+// LookupLevel describes the named logger, reporting false if no level was ever set or
+// requested for it
+func LookupLevel(name string) (LevelInfo, bool) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	e, ok := registry.entries[name]
+	if !ok {
+		return LevelInfo{}, false
+	}
+	return levelInfoLocked(name, e), true
+}
+
+// Levels describes the global level and every named logger, sorted by name with Global
+// first
+func Levels() []LevelInfo {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	infos := make([]LevelInfo, 0, len(registry.entries))
+	for name, e := range registry.entries {
+		infos = append(infos, levelInfoLocked(name, e))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name == Global || infos[j].Name == Global {
+			return infos[i].Name == Global
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func levelInfoLocked(name string, e *levelEntry) LevelInfo {
+	level, _ := e.effective()
+	info := LevelInfo{Name: name, Level: level.String(), Inherited: name != Global && e.level.Load() == inherit}
+	if !e.revertAt.IsZero() {
+		revertAt := e.revertAt
+		info.RevertAt = &revertAt
+	}
+	return info
+}
+
+type levelCtxKey struct{}
+
+// WithLevel returns a copy of ctx in which every logger logs at level or above, even when
+// its own level is higher, so that a single request can be debugged
+func WithLevel(ctx context.Context, level zerolog.Level) context.Context {
+	return context.WithValue(ctx, levelCtxKey{}, level)
+}
+
+// EffectiveLevel returns the level of the named logger for ctx, taking WithLevel into
+// account
+func EffectiveLevel(ctx context.Context, name string) zerolog.Level {
+	level, _ := effectiveLevel(ctx, entry(name))
+	return level
+}
+
+// effectiveLevel returns the level of e for ctx, and whether it comes from SetLevel or
+// WithLevel, in which case it takes precedence over the level of the Logger's backend
+func effectiveLevel(ctx context.Context, e *levelEntry) (zerolog.Level, bool) {
+	level, explicit := e.effective()
+	if ctx != nil {
+		if override, ok := ctx.Value(levelCtxKey{}).(zerolog.Level); ok && override <= level {
+			return override, true
+		}
+	}
+	return level, explicit
+}
+
+// NamedLogger logs through the current Logger, filtered by a level that can be changed at
+// runtime with SetLevel. Until a level is set, the Logger's own level applies as well; once
+// one is set with SetLevel or WithLevel, it replaces the level of the Logger returned by
+// Slog or Zerolog.
+type NamedLogger struct {
+	name  string
+	entry *levelEntry
+}
+
+// Named returns the logger for name, which follows the global level until SetLevel is
+// called for it
+func Named(name string) *NamedLogger {
+	return &NamedLogger{name: name, entry: entry(name)}
+}
+
+// Name returns the name the logger's level is set under
+func (n *NamedLogger) Name() string {
+	return n.name
+}
+
+func (n *NamedLogger) Enabled(ctx context.Context, level slog.Level) bool {
+	min, explicit := effectiveLevel(ctx, n.entry)
+	if ZerologLevel(level) < min {
+		return false
+	}
+	l := GetLogger()
+	if _, ok := l.(unfilteredLogger); ok && explicit {
+		return true
+	}
+	return l.Enabled(ctx, level)
+}
+
+func (n *NamedLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	min, explicit := effectiveLevel(ctx, n.entry)
+	if ZerologLevel(level) < min {
+		return
+	}
+	logAt(ctx, explicit, level, msg, attrs...)
+}
+
+// unfilteredLogger is implemented by the Loggers of this package, which can write a record
+// without applying their own level
+type unfilteredLogger interface {
+	logUnfiltered(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+// logAt writes a record through the current Logger, skipping its own level when explicit
+func logAt(ctx context.Context, explicit bool, level slog.Level, msg string, attrs ...slog.Attr) {
+	l := GetLogger()
+	if u, ok := l.(unfilteredLogger); ok && explicit {
+		u.logUnfiltered(ctx, level, msg, attrs...)
+		return
+	}
+	l.Log(ctx, level, msg, attrs...)
+}
+
+// Debug logs msg at debug level
+func (n *NamedLogger) Debug(ctx context.Context, msg string, attrs ...slog.Attr) {
+	n.Log(ctx, slog.LevelDebug, msg, attrs...)
+}
+
+// Info logs msg at info level
+func (n *NamedLogger) Info(ctx context.Context, msg string, attrs ...slog.Attr) {
+	n.Log(ctx, slog.LevelInfo, msg, attrs...)
+}
+
+// Warn logs msg at warn level
+func (n *NamedLogger) Warn(ctx context.Context, msg string, attrs ...slog.Attr) {
+	n.Log(ctx, slog.LevelWarn, msg, attrs...)
+}
+
+// Error logs msg at error level
+func (n *NamedLogger) Error(ctx context.Context, msg string, attrs ...slog.Attr) {
+	n.Log(ctx, slog.LevelError, msg, attrs...)
+}
+
+// ZerologNamed returns l with its level controlled at runtime under name. Events carrying
+// a context, through Event.Ctx or Logger.With().Ctx, honor WithLevel. zerolog's own
+// global level still applies, so leave zerolog.SetGlobalLevel at its default.
+func ZerologNamed(name string, l zerolog.Logger) zerolog.Logger {
+	return l.Level(zerolog.TraceLevel).Hook(levelHook{entry(name)})
+}
+
+type levelHook struct {
+	entry *levelEntry
+}
+
+func (h levelHook) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	if min, _ := effectiveLevel(e.GetCtx(), h.entry); level != zerolog.NoLevel && level < min {
+		e.Discard()
+	}
+}
@@ -0,0 +1,159 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamedLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	SetLogger(nil)
+	defer ResetLevel(Global)
+
+	named := Named("levels-test")
+	ctx := context.Background()
+
+	SetLevel(Global, zerolog.WarnLevel, 0)
+	named.Info(ctx, "hidden by global")
+	Info(ctx, "hidden by global too")
+
+	SetLevel("levels-test", zerolog.DebugLevel, 0)
+	named.Debug(ctx, "shown by own level")
+
+	ResetLevel("levels-test")
+	named.Info(ctx, "hidden again")
+
+	named.Debug(WithLevel(ctx, zerolog.DebugLevel), "shown by override")
+
+	logStr := buf.String()
+	if strings.Contains(logStr, "hidden") {
+		t.Errorf("log contains filtered messages\nLog: %s", logStr)
+	}
+	for _, expected := range []string{"shown by own level", "shown by override"} {
+		if !strings.Contains(logStr, expected) {
+			t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+		}
+	}
+}
+
+func TestNamedLevelsWithSlog(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(Slog(slog.NewJSONHandler(&buf, nil)))
+	defer SetLogger(nil)
+	defer ResetLevel("slog-levels-test")
+
+	named := Named("slog-levels-test")
+	ctx := context.Background()
+
+	named.Debug(ctx, "hidden by handler")
+	if named.Enabled(ctx, slog.LevelDebug) {
+		t.Error("Enabled() ignores the handler's level before a level is set")
+	}
+
+	SetLevel("slog-levels-test", zerolog.DebugLevel, 0)
+	named.Debug(ctx, "shown by own level")
+	if !named.Enabled(ctx, slog.LevelDebug) {
+		t.Error("Enabled() applies the handler's level over SetLevel")
+	}
+
+	ResetLevel("slog-levels-test")
+	named.Debug(WithLevel(ctx, zerolog.DebugLevel), "shown by override")
+
+	logStr := buf.String()
+	if strings.Contains(logStr, "hidden") {
+		t.Errorf("log contains filtered messages\nLog: %s", logStr)
+	}
+	for _, expected := range []string{"shown by own level", "shown by override"} {
+		if !strings.Contains(logStr, expected) {
+			t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+		}
+	}
+}
+
+func TestSetLevelReverts(t *testing.T) {
+	SetLevel("revert-test", zerolog.ErrorLevel, 0)
+	SetLevel("revert-test", zerolog.DebugLevel, 20*time.Millisecond)
+	// A second temporary change keeps reverting to the level before the first
+	SetLevel("revert-test", zerolog.TraceLevel, 20*time.Millisecond)
+
+	info, ok := LookupLevel("revert-test")
+	if !ok || info.Level != "trace" || info.RevertAt == nil {
+		t.Fatalf("LookupLevel() = %+v, %v", info, ok)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for GetLevel("revert-test") != zerolog.ErrorLevel && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := GetLevel("revert-test"); got != zerolog.ErrorLevel {
+		t.Errorf("level after revert = %s, want error", got)
+	}
+	if info, _ := LookupLevel("revert-test"); info.RevertAt != nil {
+		t.Errorf("RevertAt = %v after reverting", info.RevertAt)
+	}
+}
+
+func TestSetLevelCancelsRevert(t *testing.T) {
+	SetLevel("cancel-test", zerolog.DebugLevel, 10*time.Millisecond)
+	SetLevel("cancel-test", zerolog.WarnLevel, 0)
+	time.Sleep(30 * time.Millisecond)
+
+	if got := GetLevel("cancel-test"); got != zerolog.WarnLevel {
+		t.Errorf("level = %s, want the permanent change to stick", got)
+	}
+}
+
+func TestListLevels(t *testing.T) {
+	Named("levels-list-b")
+	SetLevel("levels-list-a", zerolog.ErrorLevel, 0)
+
+	infos := Levels()
+	if infos[0].Name != Global {
+		t.Errorf("first level = %q, want %q", infos[0].Name, Global)
+	}
+	var a, b *LevelInfo
+	for i := range infos {
+		switch infos[i].Name {
+		case "levels-list-a":
+			a = &infos[i]
+		case "levels-list-b":
+			b = &infos[i]
+		}
+	}
+	if a == nil || a.Level != "error" || a.Inherited {
+		t.Errorf("levels-list-a = %+v", a)
+	}
+	if b == nil || !b.Inherited || b.Level != GetLevel(Global).String() {
+		t.Errorf("levels-list-b = %+v", b)
+	}
+	if _, ok := LookupLevel("never-used"); ok {
+		t.Error("LookupLevel() reported an unknown logger")
+	}
+}
+
+func TestZerologNamed(t *testing.T) {
+	var buf bytes.Buffer
+	l := ZerologNamed("zerolog-test", zerolog.New(&buf))
+	SetLevel("zerolog-test", zerolog.WarnLevel, 0)
+
+	l.Info().Msg("hidden")
+	l.Warn().Msg("shown")
+	l.Debug().Ctx(WithLevel(context.Background(), zerolog.DebugLevel)).Msg("overridden")
+
+	logStr := buf.String()
+	if strings.Contains(logStr, "hidden") {
+		t.Errorf("log contains filtered messages\nLog: %s", logStr)
+	}
+	for _, expected := range []string{"shown", "overridden"} {
+		if !strings.Contains(logStr, expected) {
+			t.Errorf("log doesn't contain %q\nLog: %s", expected, logStr)
+		}
+	}
+}
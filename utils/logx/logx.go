@@ -0,0 +1,108 @@
+package logx
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorKey is the attribute key errors are logged under
+const ErrorKey = "error"
+
+// Logger is the logging backend used by mjolnir's middleware and errorx. Attributes use
+// log/slog types so that backends need not depend on each other. Implementations must be
+// safe for concurrent use.
+type Logger interface {
+	// Enabled reports whether records at level would be logged for ctx
+	Enabled(ctx context.Context, level slog.Level) bool
+	// Log writes a record. ctx carries request-scoped values such as the request ID.
+	Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr)
+}
+
+// Slog returns a Logger writing to h. The handler's level applies until a level is set with
+// SetLevel or WithLevel.
+func Slog(h slog.Handler) Logger {
+	return slogLogger{h}
+}
+
+type slogLogger struct {
+	h slog.Handler
+}
+
+func (l slogLogger) Enabled(ctx context.Context, level slog.Level) bool {
+	return l.h.Enabled(ctx, level)
+}
+
+func (l slogLogger) Log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if !l.h.Enabled(ctx, level) {
+		return
+	}
+	l.logUnfiltered(ctx, level, msg, attrs...)
+}
+
+func (l slogLogger) logUnfiltered(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	r := slog.NewRecord(time.Now(), level, msg, 0)
+	r.AddAttrs(attrs...)
+	_ = l.h.Handle(ctx, r)
+}
+
+type loggerHolder struct {
+	Logger
+}
+
+var current atomic.Pointer[loggerHolder]
+
+func init() {
+	SetLogger(nil)
+}
+
+// SetLogger replaces the Logger used by mjolnir. A nil Logger restores the default,
+// Zerolog(nil), which writes to zerolog's global logger.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = Zerolog(nil)
+	}
+	current.Store(&loggerHolder{l})
+}
+
+// GetLogger returns the Logger set with SetLogger
+func GetLogger() Logger {
+	return current.Load().Logger
+}
+
+// Debug logs msg at debug level, subject to the Global level
+func Debug(ctx context.Context, msg string, attrs ...slog.Attr) {
+	std.Log(ctx, slog.LevelDebug, msg, attrs...)
+}
+
+// Info logs msg at info level, subject to the Global level
+func Info(ctx context.Context, msg string, attrs ...slog.Attr) {
+	std.Log(ctx, slog.LevelInfo, msg, attrs...)
+}
+
+// Warn logs msg at warn level, subject to the Global level
+func Warn(ctx context.Context, msg string, attrs ...slog.Attr) {
+	std.Log(ctx, slog.LevelWarn, msg, attrs...)
+}
+
+// Error logs msg at error level, subject to the Global level
+func Error(ctx context.Context, msg string, attrs ...slog.Attr) {
+	std.Log(ctx, slog.LevelError, msg, attrs...)
+}
+
+// Err returns an attribute for err under ErrorKey
+func Err(err error) slog.Attr {
+	return slog.Any(ErrorKey, err)
+}
+
+// MapAttrs converts a map of fields to attributes, sorted by key
+func MapAttrs(fields map[string]any) []slog.Attr {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for k, v := range fields {
+		attrs = append(attrs, slog.Any(k, v))
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
@@ -0,0 +1,92 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZerolog(t *testing.T) {
+	var buf bytes.Buffer
+	zl := zerolog.New(&buf).Level(zerolog.InfoLevel)
+	l := Zerolog(&zl)
+
+	l.Log(context.Background(), slog.LevelInfo, "hello",
+		slog.String("s", "x"),
+		slog.Int("i", 1),
+		slog.Bool("b", true),
+		slog.Duration("d", 1500*time.Millisecond),
+		Err(errors.New("boom")),
+		slog.Group("g", slog.String("inner", "y")),
+		slog.Group("", slog.String("inlined", "z")),
+		slog.Any("raw", json.RawMessage(`{"a":1}`)),
+		slog.Attr{},
+	)
+	l.Log(context.Background(), slog.LevelDebug, "hidden")
+
+	expected := `{"level":"info","s":"x","i":1,"b":true,"d":1500,"error":"boom","g":{"inner":"y"},"inlined":"z","raw":{"a":1},"message":"hello"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("got  %s\nwant %s", buf.String(), expected)
+	}
+	if l.Enabled(context.Background(), slog.LevelDebug) || !l.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("Enabled() does not follow the logger level")
+	}
+}
+
+func TestZerologGlobal(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+
+	SetLogger(nil)
+	Warn(context.Background(), "careful")
+
+	if !strings.Contains(buf.String(), `"level":"warn"`) || !strings.Contains(buf.String(), `"message":"careful"`) {
+		t.Errorf("expected the global zerolog logger to be used, got %q", buf.String())
+	}
+}
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+
+	SetLogger(Slog(h))
+	defer SetLogger(nil)
+
+	Error(context.Background(), "failed", slog.String("request_id", "abc"), Err(errors.New("boom")))
+	Debug(context.Background(), "hidden")
+
+	expected := `{"level":"ERROR","msg":"failed","request_id":"abc","error":"boom"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("got  %s\nwant %s", buf.String(), expected)
+	}
+}
+
+func TestMapAttrs(t *testing.T) {
+	attrs := MapAttrs(map[string]any{"b": 2, "a": "x"})
+	if len(attrs) != 2 || attrs[0].Key != "a" || attrs[1].Key != "b" {
+		t.Errorf("MapAttrs() = %v, want sorted attributes", attrs)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	for _, level := range []zerolog.Level{zerolog.TraceLevel, zerolog.DebugLevel, zerolog.InfoLevel, zerolog.WarnLevel, zerolog.ErrorLevel} {
+		if got := ZerologLevel(SlogLevel(level)); got != level {
+			t.Errorf("ZerologLevel(SlogLevel(%s)) = %s", level, got)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package logx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"log/slog"
+)
+
+// Zerolog returns a Logger writing to l. A nil l writes to zerolog's global log.Logger as
+// it is when each record is logged, so replacing the global logger takes effect at once.
+// The logger's level applies until a level is set with SetLevel or WithLevel.
+func Zerolog(l *zerolog.Logger) Logger {
+	return zerologLogger{l}
+}
+
+type zerologLogger struct {
+	l *zerolog.Logger
+}
+
+func (z zerologLogger) logger() *zerolog.Logger {
+	if z.l == nil {
+		return &log.Logger
+	}
+	return z.l
+}
+
+func (z zerologLogger) Enabled(_ context.Context, level slog.Level) bool {
+	l := z.logger()
+	zl := ZerologLevel(level)
+	return zl >= l.GetLevel() && zl >= zerolog.GlobalLevel()
+}
+
+func (z zerologLogger) Log(_ context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	writeZerolog(z.logger(), level, msg, attrs)
+}
+
+func (z zerologLogger) logUnfiltered(_ context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	l := z.logger().Level(zerolog.TraceLevel)
+	writeZerolog(&l, level, msg, attrs)
+}
+
+func writeZerolog(l *zerolog.Logger, level slog.Level, msg string, attrs []slog.Attr) {
+	event := l.WithLevel(ZerologLevel(level))
+	if event == nil {
+		return
+	}
+	for _, attr := range attrs {
+		event = appendAttr(event, attr)
+	}
+	event.Msg(msg)
+}
+
+// ZerologFor returns a zerolog logger for ctx that writes through the current Logger,
+// filtered by the Global level and WithLevel like ZerologNamed, for handlers that log with
+// zerolog.Ctx whichever backend is configured
+func ZerologFor(ctx context.Context) zerolog.Logger {
+	if z, ok := GetLogger().(zerologLogger); ok {
+		return ZerologNamed(Global, *z.logger())
+	}
+	return ZerologNamed(Global, zerolog.New(loggerWriter{ctx: ctx}))
+}
+
+// loggerWriter forwards the JSON events of a zerolog logger to the current Logger
+type loggerWriter struct {
+	ctx context.Context
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w loggerWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return 0, err
+	}
+	msg, _ := fields[zerolog.MessageFieldName].(string)
+	delete(fields, zerolog.MessageFieldName)
+	delete(fields, zerolog.LevelFieldName)
+
+	slogLevel := slog.LevelInfo
+	if level != zerolog.NoLevel {
+		slogLevel = SlogLevel(level)
+	}
+	// The event already passed the level hook of ZerologNamed
+	_, explicit := effectiveLevel(w.ctx, global)
+	logAt(w.ctx, explicit, slogLevel, msg, MapAttrs(fields)...)
+	return len(p), nil
+}
+
+// ZerologLevel maps a slog level to the nearest zerolog level at or below it
+func ZerologLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zerolog.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zerolog.WarnLevel
+	case level >= slog.LevelInfo:
+		return zerolog.InfoLevel
+	case level >= slog.LevelDebug:
+		return zerolog.DebugLevel
+	default:
+		return zerolog.TraceLevel
+	}
+}
+
+// SlogLevel maps a zerolog level to a slog level
+func SlogLevel(level zerolog.Level) slog.Level {
+	switch level {
+	case zerolog.TraceLevel:
+		return slog.LevelDebug - 4
+	case zerolog.DebugLevel:
+		return slog.LevelDebug
+	case zerolog.InfoLevel:
+		return slog.LevelInfo
+	case zerolog.WarnLevel:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// appendAttr adds attr to event, or to a nested dictionary, following slog's rules: empty
+// attributes are dropped and groups without a key are inlined
+func appendAttr(event *zerolog.Event, attr slog.Attr) *zerolog.Event {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return event
+	}
+
+	v := attr.Value
+	switch v.Kind() {
+	case slog.KindString:
+		return event.Str(attr.Key, v.String())
+	case slog.KindInt64:
+		return event.Int64(attr.Key, v.Int64())
+	case slog.KindUint64:
+		return event.Uint64(attr.Key, v.Uint64())
+	case slog.KindFloat64:
+		return event.Float64(attr.Key, v.Float64())
+	case slog.KindBool:
+		return event.Bool(attr.Key, v.Bool())
+	case slog.KindDuration:
+		return event.Dur(attr.Key, v.Duration())
+	case slog.KindTime:
+		return event.Time(attr.Key, v.Time())
+	case slog.KindGroup:
+		group := v.Group()
+		if attr.Key == "" {
+			for _, a := range group {
+				event = appendAttr(event, a)
+			}
+			return event
+		}
+		if len(group) == 0 {
+			return event
+		}
+		dict := zerolog.Dict()
+		for _, a := range group {
+			dict = appendAttr(dict, a)
+		}
+		return event.Dict(attr.Key, dict)
+	default:
+		if err, ok := v.Any().(error); ok {
+			return event.AnErr(attr.Key, err)
+		}
+		return event.Interface(attr.Key, v.Any())
+	}
+}
@@ -24,3 +24,14 @@ func (o Option[T]) IsEmpty() bool {
 func (o Option[T]) Get() T {
 	return o.value
 }
+
+func (o *Option[T]) Set(value T) {
+	o.value = value
+	o.empty = false
+}
+
+func (o *Option[T]) Clear() {
+	var zero T
+	o.value = zero
+	o.empty = true
+}
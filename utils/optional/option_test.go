@@ -267,3 +267,23 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestSetAndClear(t *testing.T) {
+	opt := Empty[string]()
+
+	opt.Set("value")
+	if opt.IsEmpty() {
+		t.Error("Set() should make the option non-empty")
+	}
+	if got := opt.Get(); got != "value" {
+		t.Errorf("Get() after Set() = %q, want %q", got, "value")
+	}
+
+	opt.Clear()
+	if !opt.IsEmpty() {
+		t.Error("Clear() should make the option empty")
+	}
+	if got := opt.Get(); got != "" {
+		t.Errorf("Get() after Clear() = %q, want zero value", got)
+	}
+}